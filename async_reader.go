@@ -1,8 +1,14 @@
 package extio
 
 import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
@@ -11,19 +17,150 @@ type (
 	// an internal channel.
 	AsyncReader struct {
 		r     io.Reader
+		src   io.Reader // r before any decompression
+		tee   io.Writer // set by NewAsyncTeeReader
 		c     chan segment
 		abort chan struct{}
+		stop  chan struct{}
 
 		bufs sync.Pool
 		buf  []byte
+		err  error  // returned by Read once buf is exhausted
+		seg  []byte // lent by NextSegment, or read in place by DoubleBuffer
+		dead []byte // poisoned by DebugSegments
 
-		BufferSize  int
+		cur  []byte      // the unread rest of seg under DoubleBuffer
+		free chan []byte // the buffers not in use under DoubleBuffer
+
+		deadline atomic.Value // time.Time set by SetReadDeadline
+		started  sync.Once
+		shut     sync.Once // closes abort
+
+		delivered int64 // bytes delivered to the consumer, accessed atomically
+		fetched   int64 // bytes sent over c, accessed atomically
+
+		drained chan struct{} // signaled as data is delivered, under MaxPrefetchBytes
+
+		// BufferSize is the size in bytes of each buffer read from
+		// the io.Reader.  Values less than one are replaced with
+		// DefaultAsyncBufferSize by Start.  (default: 2mb)
+		BufferSize int
+		// ChannelSize is the number of buffers that may be read ahead
+		// of the consumer.  Negative values are replaced with
+		// DefaultReadChanLength by Start.  (default: 32)
 		ChannelSize int
+		// MaxPrefetchBytes, if greater than zero, bounds the bytes
+		// read from the io.Reader that have yet to be delivered, in
+		// segments queued on the channel and in the buffer of Read,
+		// as reported by BytesBuffered.  The buffering goroutine
+		// stops reading once another buffer would exceed it, and
+		// resumes as reads drain the data, so memory may be bounded
+		// precisely with a large BufferSize.  Whichever of it and
+		// ChannelSize is tighter applies.  A buffer is always read
+		// when none is queued, so a limit below BufferSize
+		// prefetches one buffer at a time, and a Read waiting for
+		// more than the limit may exceed it by one buffer.
+		// (default: 0, unlimited)
+		MaxPrefetchBytes int
+
+		// MinSegment, if greater than zero, delivers data in
+		// segments of between MinSegment and MaxSegment bytes as it
+		// arrives, rather than waiting for BufferSize bytes.  The
+		// buffering goroutine accumulates data until it holds at
+		// least MinSegment bytes, delivering it then for efficiency,
+		// but delivers as soon as MaxSegment bytes are held.  The
+		// final segment at EOF is delivered regardless of size.
+		// (default: 0)
+		MinSegment int
+		// MaxSegment is the largest segment delivered when
+		// MinSegment is set.  Values less than MinSegment are
+		// replaced with BufferSize, or MinSegment if that is
+		// larger, by Start.  (default: 0)
+		MaxSegment int
+		// IdleTimeout, when MinSegment is set, delivers a segment
+		// smaller than MinSegment once no data has arrived for this
+		// long, bounding the latency of a slow io.Reader.  When
+		// zero, a small segment waits for more data or EOF.
+		// (default: 0)
+		IdleTimeout time.Duration
+
+		// IdleFlush, if greater than zero, delivers a partially
+		// filled buffer once no data has arrived for this long,
+		// rather than waiting for BufferSize bytes, bounding the
+		// latency of a source that sends data in bursts with idle
+		// gaps between them.  Full buffers are still delivered
+		// during bursts.  This is MinSegment and MaxSegment of
+		// BufferSize with an IdleTimeout of IdleFlush, and is
+		// ignored when MinSegment is set. (default: 0)
+		IdleFlush time.Duration
+
+		// DoubleBuffer reads with exactly two buffers of BufferSize,
+		// the buffering goroutine filling one while Read copies out
+		// of the other in place, and swapping them once it is
+		// exhausted, rather than passing segments over a channel
+		// and copying them into an intermediate buffer.  It is
+		// optimized for the sequential throughput of a single
+		// consumer reading a fast io.Reader with Read, typically
+		// with a large BufferSize, not for latency or for workloads
+		// of many small segments.  ChannelSize, MinSegment,
+		// IdleFlush and DebugSegments are ignored. (default: false)
+		DoubleBuffer bool
+
+		// SizeHint is the expected total size in bytes of the
+		// io.Reader, used to presize the result of Drain.  If zero
+		// when Start is called, the io.Reader's Len() is used when
+		// it has that method.
+		SizeHint int
+
+		// AutoDecompress enables detection of compressed input.  The
+		// buffering goroutine peeks the first bytes of the io.Reader
+		// and, if they match the magic number of a supported format,
+		// reads through the matching decompressor so that Read yields
+		// decompressed data.  Input that matches no format is read
+		// unchanged, the peeked bytes included.  Supported formats are
+		// gzip (1f 8b) and bzip2 ("BZh" followed by a block size digit).
+		// zlib is not detected as its two byte header is too easily
+		// mistaken for plain text.  (default: false)
+		AutoDecompress bool
+
+		// RetryLimit, if greater than zero, retries reading from
+		// an io.Reader that is also an io.Seeker, such as *os.File
+		// or *bytes.Reader, when it fails.  The io.Reader is seeked
+		// back to the byte after the last one it returned and read
+		// again, so the stream is neither duplicated nor has gaps.
+		// Up to RetryLimit consecutive failures are retried before
+		// the error is returned.  io.Readers that cannot seek are
+		// never retried. (default: 0)
+		RetryLimit int
+		// RetryBackoff is the wait before the first retry of a
+		// failure, doubling with each consecutive retry.
+		// (default: 0)
+		RetryBackoff time.Duration
+
+		// DebugSegments helps find segments from NextSegment that
+		// are used after they are released.  Released segments are
+		// overwritten with 0xa5 bytes and not reused, so retained
+		// data is visibly corrupt, and NextSegment panics if the
+		// previously released segment was written to after release.
+		// (default: false)
+		DebugSegments bool
 	}
 	segment struct {
 		b   []byte
 		err error
 	}
+
+	// retryReader retries reads from a failed io.ReadSeeker from
+	// the offset after the last byte it returned.
+	retryReader struct {
+		r       io.ReadSeeker
+		off     int64
+		limit   int
+		backoff time.Duration
+		abort   chan struct{}
+		retries int  // consecutive failures
+		seek    bool // r must be seeked to off before reading
+	}
 )
 
 // NewAsyncReader creates a new AsyncReader from the supplied io.Reader
@@ -31,21 +168,134 @@ type (
 func NewAsyncReader(r io.Reader) *AsyncReader {
 	return &AsyncReader{
 		r:           r,
+		src:         r,
 		abort:       make(chan struct{}),
-		BufferSize:  2 << 20,
-		ChannelSize: 32,
+		stop:        make(chan struct{}),
+		BufferSize:  DefaultAsyncBufferSize,
+		ChannelSize: DefaultReadChanLength,
 	}
 }
 
-// Start initializes the goroutine that buffers data from the io.Reader
+// NewAsyncTeeReader creates a new AsyncReader, as NewAsyncReader
+// does, that also writes the data it reads from r to tee, as
+// io.TeeReader does, such as to archive a stream while it is
+// processed.  The writes to tee are made by the buffering goroutine
+// as it prefetches, so tee receives the data ahead of the consumer,
+// and is held back by a slow consumer only once the prefetch is
+// full, as bounded by ChannelSize and MaxPrefetchBytes.  tee
+// receives the data of r as read, before AutoDecompress.  If a
+// Write to tee fails, the buffering goroutine stops, and the error
+// is returned by Read once the data read before it is, as an error
+// of r would be.
+func NewAsyncTeeReader(r io.Reader, tee io.Writer) *AsyncReader {
+	ar := NewAsyncReader(r)
+	ar.tee = tee
+	return ar
+}
+
+// Start initializes the goroutine that buffers data from the io.Reader.
+// It is called by the first Read, WriteTo, NextSegment or Drain if it
+// has not been already, so it need only be called to begin buffering
+// ahead of them.  Subsequent calls have no effect, and once Close
+// has been called no goroutine is started.
 func (ar *AsyncReader) Start() {
+	ar.started.Do(ar.start)
+}
+
+func (ar *AsyncReader) start() {
+	if ar.closed() {
+		// nothing is read once closed
+		ar.c = make(chan segment)
+		close(ar.c)
+		return
+	}
+	if ar.BufferSize < 1 {
+		ar.BufferSize = DefaultAsyncBufferSize
+	}
+	if ar.ChannelSize < 0 {
+		ar.ChannelSize = DefaultReadChanLength
+	}
+	if l, ok := ar.r.(interface {
+		Len() int
+	}); ok && ar.SizeHint == 0 {
+		ar.SizeHint = l.Len()
+	}
+	var (
+		size = ar.BufferSize
+		min  int
+		idle time.Duration
+	)
+	switch {
+	case ar.DoubleBuffer:
+		// filled buffers are swapped through the channel
+		ar.ChannelSize = 1
+		ar.DebugSegments = false
+		ar.free = make(chan []byte, 2)
+		ar.free <- make([]byte, size)
+		ar.free <- make([]byte, size)
+	case ar.MinSegment > 0:
+		if ar.MaxSegment < ar.MinSegment {
+			ar.MaxSegment = ar.BufferSize
+			if ar.MaxSegment < ar.MinSegment {
+				ar.MaxSegment = ar.MinSegment
+			}
+		}
+		size, min, idle = ar.MaxSegment, ar.MinSegment, ar.IdleTimeout
+	case ar.IdleFlush > 0:
+		min, idle = ar.BufferSize, ar.IdleFlush
+	}
+	if rs, ok := ar.r.(io.ReadSeeker); ok && ar.RetryLimit > 0 {
+		if off, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			ar.r = &retryReader{
+				r:       rs,
+				off:     off,
+				limit:   ar.RetryLimit,
+				backoff: ar.RetryBackoff,
+				abort:   ar.abort,
+			}
+		}
+	}
+	if ar.tee != nil {
+		// retried reads are not written twice
+		ar.r = io.TeeReader(ar.r, ar.tee)
+	}
+	if ar.MaxPrefetchBytes > 0 {
+		ar.drained = make(chan struct{}, 1)
+	}
 	ar.c = make(chan segment, ar.ChannelSize)
-	ar.bufs = sync.Pool{New: func() interface{} { return make([]byte, ar.BufferSize) }}
+	ar.bufs = sync.Pool{New: func() interface{} { return make([]byte, size) }}
 	go func() {
 		defer close(ar.c)
+		if ar.AutoDecompress {
+			r, err := autoDecompress(ar.r)
+			if err != nil {
+				select {
+				case <-ar.abort:
+				case ar.c <- segment{err: err}:
+				}
+				return
+			}
+			ar.r = r
+		}
+		if min > 0 {
+			ar.window(min, size, idle)
+			return
+		}
 		for {
-			buf := ar.bufs.Get().([]byte)
+			select {
+			case <-ar.stop:
+				return
+			default:
+			}
+			if !ar.waitPrefetch(size) {
+				return
+			}
+			buf, ok := ar.get()
+			if !ok {
+				return
+			}
 			n, err := io.ReadFull(ar.r, buf)
+			atomic.AddInt64(&ar.fetched, int64(n))
 			select {
 			case <-ar.abort:
 				return
@@ -59,28 +309,301 @@ func (ar *AsyncReader) Start() {
 	}()
 }
 
+// Waits until reading size more bytes would keep the bytes buffered
+// within MaxPrefetchBytes, or nothing is queued on the channel, as
+// when a Read waits for more data than the limit.  Reports false if
+// stopped or aborted while waiting.
+func (ar *AsyncReader) waitPrefetch(size int) bool {
+	if ar.drained == nil {
+		return true
+	}
+	for {
+		if len(ar.c) == 0 || ar.BytesBuffered()+size <= ar.MaxPrefetchBytes {
+			return true
+		}
+		select {
+		case <-ar.drained:
+		case <-ar.stop:
+			return false
+		case <-ar.abort:
+			return false
+		}
+	}
+}
+
+// Counts n bytes delivered to the consumer.
+func (ar *AsyncReader) consumed(n int) {
+	atomic.AddInt64(&ar.delivered, int64(n))
+	if n > 0 {
+		ar.wake()
+	}
+}
+
+// Wakes the buffering goroutine if it waits on MaxPrefetchBytes, as
+// data is delivered or taken from the channel.
+func (ar *AsyncReader) wake() {
+	if ar.drained != nil {
+		select {
+		case ar.drained <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Returns a buffer to read into, waiting for one to be free under
+// DoubleBuffer.  Reports false if stopped or aborted while waiting.
+func (ar *AsyncReader) get() ([]byte, bool) {
+	if ar.free == nil {
+		return ar.bufs.Get().([]byte), true
+	}
+	select {
+	case buf := <-ar.free:
+		return buf, true
+	case <-ar.stop:
+	case <-ar.abort:
+	}
+	return nil, false
+}
+
+// Returns a buffer received from the channel for reuse.
+func (ar *AsyncReader) put(buf []byte) {
+	if ar.free == nil {
+		ar.bufs.Put(buf)
+		return
+	}
+	// there are only ever two, so there is always room
+	ar.free <- buf[:cap(buf)]
+}
+
+// Reads from the io.Reader in a separate goroutine, so that waiting
+// for data may time out, and delivers it in segments of min to max
+// bytes, or fewer once no data has arrived for idle.
+func (ar *AsyncReader) window(min, max int, idle time.Duration) {
+	var (
+		raw = make(chan segment)
+		ack = make(chan struct{})
+	)
+	go func() {
+		defer close(raw)
+		buf := make([]byte, max)
+		for {
+			select {
+			case <-ar.stop:
+				return
+			default:
+			}
+			if !ar.waitPrefetch(max) {
+				return
+			}
+			n, err := ar.r.Read(buf)
+			select {
+			case <-ar.abort:
+				return
+			case raw <- segment{b: buf[:n], err: err}:
+			}
+			if err != nil {
+				return
+			}
+			// buf is reused once copied
+			select {
+			case <-ar.abort:
+				return
+			case <-ack:
+			}
+		}
+	}()
+
+	var (
+		seg     = ar.bufs.Get().([]byte)[:0]
+		t       *time.Timer
+		expired <-chan time.Time
+	)
+	deliver := func(err error) bool {
+		if t != nil {
+			t.Stop()
+			expired = nil
+		}
+		atomic.AddInt64(&ar.fetched, int64(len(seg)))
+		select {
+		case <-ar.abort:
+			return false
+		case ar.c <- segment{b: seg, err: err}:
+		}
+		seg = ar.bufs.Get().([]byte)[:0]
+		return true
+	}
+	for {
+		select {
+		case <-ar.abort:
+			return
+		case <-expired:
+			expired = nil
+			if !deliver(nil) {
+				return
+			}
+		case s, open := <-raw:
+			if !open {
+				// stopped by Unwrap
+				if len(seg) > 0 {
+					deliver(nil)
+				}
+				return
+			}
+			for data := s.b; len(data) > 0; {
+				n := copy(seg[len(seg):cap(seg)], data)
+				seg, data = seg[:len(seg)+n], data[n:]
+				if len(seg) == cap(seg) && !deliver(nil) {
+					return
+				}
+			}
+			if s.err != nil {
+				// includes io.EOF
+				deliver(s.err)
+				return
+			}
+			select {
+			case <-ar.abort:
+				return
+			case ack <- struct{}{}:
+			}
+			switch {
+			case len(seg) >= min:
+				if !deliver(nil) {
+					return
+				}
+			case len(seg) > 0 && idle > 0:
+				if t != nil {
+					t.Stop()
+				}
+				t = time.NewTimer(idle)
+				expired = t.C
+			}
+		}
+	}
+}
+
+// Read reads from r, retrying from off if it fails.  Data returned
+// along with a failure is returned with a nil error, and the retry
+// is made by the next Read.
+func (rr *retryReader) Read(p []byte) (int, error) {
+	for {
+		if rr.seek {
+			t := time.NewTimer(rr.backoff << uint(rr.retries-1))
+			select {
+			case <-rr.abort:
+				t.Stop()
+				return 0, ErrAborted
+			case <-t.C:
+			}
+			if _, err := rr.r.Seek(rr.off, io.SeekStart); err != nil {
+				return 0, err
+			}
+			rr.seek = false
+		}
+		n, err := rr.r.Read(p)
+		rr.off += int64(n)
+		if err == nil || err == io.EOF {
+			if n > 0 {
+				rr.retries = 0
+			}
+			return n, err
+		}
+		if rr.retries >= rr.limit {
+			return n, err
+		}
+		rr.retries++
+		rr.seek = true
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// autoDecompress peeks at the magic number of r and returns a reader
+// of its decompressed data, or of r unchanged if no supported format
+// is detected.
+func autoDecompress(r io.Reader) (io.Reader, error) {
+	var magic [4]byte
+	n, err := io.ReadFull(r, magic[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(magic[:n]), r)
+	switch {
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(r)
+	case n == 4 && string(magic[:3]) == "BZh" && magic[3] >= '1' && magic[3] <= '9':
+		return bzip2.NewReader(r), nil
+	}
+	return r, nil
+}
+
 // Read takes a byte slice and copies bytes into it
 // and returns number of bytes read and any error encountered.
-// Will emit io.EOF at completion.
+// Will emit io.EOF at completion.  If the io.Reader fails, all
+// data read before the failure is returned before its error.  Once
+// Close is called, it and every subsequent Read returns ErrAborted.
 func (ar *AsyncReader) Read(b []byte) (int, error) {
-	var (
-		s    segment
-		open bool
-	)
+	n, err := ar.read(b)
+	ar.consumed(n)
+	return n, err
+}
+
+// read is Read without counting the bytes delivered.
+func (ar *AsyncReader) read(b []byte) (int, error) {
+	if ar.closed() {
+		return 0, ErrAborted
+	}
+	ar.Start()
+	if ar.free != nil {
+		return ar.readDouble(b)
+	}
+	ar.releaseSegment()
+	var expired <-chan time.Time
+	if t, _ := ar.deadline.Load().(time.Time); !t.IsZero() && len(ar.buf) < len(b) {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	// receive appends a segment to buf, and reports whether
+	// the channel is still open
+	receive := func(s segment, open bool) bool {
+		if !open {
+			return false
+		}
+		ar.buf = append(ar.buf, s.b...)
+		ar.put(s.b)
+		ar.wake()
+		if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+			ar.err = s.err
+		}
+		return true
+	}
 LOOP:
-	for len(ar.buf) < len(b) {
+	for len(ar.buf) < len(b) && ar.err == nil {
 		select {
 		case <-ar.abort:
-			return 0, nil
-		case s, open = <-ar.c:
-			if !open {
+			return 0, ErrAborted
+		case s, open := <-ar.c:
+			if !receive(s, open) {
 				break LOOP
 			}
-			if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
-				return 0, s.err
+		case <-expired:
+			// data, the end of the stream and abort take precedence
+			select {
+			case <-ar.abort:
+				return 0, ErrAborted
+			case s, open := <-ar.c:
+				if !receive(s, open) {
+					break LOOP
+				}
+				continue
+			default:
+			}
+			if len(ar.buf) > 0 {
+				break LOOP
 			}
-			ar.buf = append(ar.buf, s.b...)
-			ar.bufs.Put(s.b)
+			return 0, os.ErrDeadlineExceeded
 		}
 	}
 	if len(ar.buf) > len(b) {
@@ -94,12 +617,409 @@ LOOP:
 		ar.buf = ar.buf[:0]
 		return n, nil
 	}
+	if ar.err != nil {
+		return 0, ar.err
+	}
 	return 0, io.EOF
 }
 
+// WriteTo implements io.WriterTo, so that io.Copy writes each buffer
+// read from the io.Reader to w directly rather than copying it
+// through the buffer of Read.  Data already buffered by Read is
+// written first.  It returns the number of bytes written and nil
+// once the io.Reader reaches EOF, the first error writing to w, or
+// the error of the io.Reader once all data read before it is
+// written.  It returns ErrAborted if Close is called, as Read does.
+// SetReadDeadline does not apply to WriteTo.
+func (ar *AsyncReader) WriteTo(w io.Writer) (int64, error) {
+
+	if ar.closed() {
+		return 0, ErrAborted
+	}
+
+	ar.Start()
+	ar.releaseSegment()
+
+	var n int64
+
+	write := func(b []byte) error {
+		nn, err := w.Write(b)
+		n += int64(nn)
+		ar.consumed(nn)
+		if err == nil && nn < len(b) {
+			err = io.ErrShortWrite
+		}
+		return err
+	}
+
+	if len(ar.buf) > 0 {
+		err := write(ar.buf)
+		ar.buf = ar.buf[:0]
+		if err != nil {
+			return n, err
+		}
+	}
+	if ar.err != nil {
+		return n, ar.err
+	}
+
+	for {
+		select {
+		case <-ar.abort:
+			return n, ErrAborted
+		case s, open := <-ar.c:
+			if !open {
+				return n, nil
+			}
+			if ar.closed() {
+				// abort takes precedence over data
+				ar.put(s.b[:cap(s.b)])
+				return n, ErrAborted
+			}
+			err := write(s.b)
+			ar.put(s.b[:cap(s.b)])
+			if err != nil {
+				return n, err
+			}
+			if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+				ar.err = s.err
+				return n, s.err
+			}
+		}
+	}
+
+}
+
+// Read for DoubleBuffer, copying out of the buffer received in place.
+func (ar *AsyncReader) readDouble(b []byte) (int, error) {
+	if len(ar.buf) > 0 {
+		// spilled by Remaining
+		n := copy(b, ar.buf)
+		ar.buf = ar.buf[:copy(ar.buf, ar.buf[n:])]
+		return n, nil
+	}
+	var expired <-chan time.Time
+	if t, _ := ar.deadline.Load().(time.Time); !t.IsZero() && len(ar.cur) == 0 {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for len(ar.cur) == 0 && len(b) > 0 {
+		// swap the exhausted buffer for the next
+		ar.releaseSegment()
+		if ar.err != nil {
+			return 0, ar.err
+		}
+		var (
+			s    segment
+			open bool
+		)
+		select {
+		case <-ar.abort:
+			return 0, ErrAborted
+		case s, open = <-ar.c:
+		case <-expired:
+			select {
+			case <-ar.abort:
+				return 0, ErrAborted
+			case s, open = <-ar.c:
+			default:
+				return 0, os.ErrDeadlineExceeded
+			}
+		}
+		if !open {
+			return 0, io.EOF
+		}
+		if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+			ar.err = s.err
+		}
+		ar.seg, ar.cur = s.b, s.b
+	}
+	n := copy(b, ar.cur)
+	ar.cur = ar.cur[n:]
+	return n, nil
+}
+
+// Reports whether Close has been called.
+func (ar *AsyncReader) closed() bool {
+	select {
+	case <-ar.abort:
+		return true
+	default:
+		return false
+	}
+}
+
+// Moves the unread rest of the buffer being read by DoubleBuffer
+// into buf, so that it may be released.
+func (ar *AsyncReader) spill() {
+	if len(ar.cur) > 0 {
+		ar.buf = append(ar.buf, ar.cur...)
+	}
+	ar.cur = nil
+}
+
+// SetReadDeadline sets the deadline for Reads, as net.Conn does, so
+// that a consumer may poll a stalled io.Reader with a timeout rather
+// than block indefinitely.  A Read that has no data to return by t
+// returns os.ErrDeadlineExceeded, or any data that arrived before t,
+// and the AsyncReader remains usable with no data lost.  The end of
+// the stream and Close take precedence over the deadline.  The
+// deadline applies to Reads that begin after it is set.  A zero t
+// clears the deadline.  It is safe to call concurrently with Read.
+func (ar *AsyncReader) SetReadDeadline(t time.Time) error {
+	ar.deadline.Store(t)
+	return nil
+}
+
+// BytesRead returns the number of bytes delivered so far by Read,
+// WriteTo, NextSegment, Drain and FlushTo.  It is safe to call
+// concurrently with them, such as to report progress.
+func (ar *AsyncReader) BytesRead() int64 {
+	return atomic.LoadInt64(&ar.delivered)
+}
+
+// BytesBuffered returns the number of bytes read from the io.Reader
+// that have yet to be delivered, whether in segments queued on the
+// channel or in the buffer of Read, as a guide to tuning BufferSize
+// and ChannelSize.  A buffer being filled by the goroutine is not
+// counted until it is queued.  It is safe to call concurrently with
+// the other methods.
+func (ar *AsyncReader) BytesBuffered() int {
+	return int(atomic.LoadInt64(&ar.fetched) - atomic.LoadInt64(&ar.delivered))
+}
+
+// Drain reads the remainder of the stream into a single slice,
+// appending buffered segments directly rather than growing the
+// result repeatedly as ioutil.ReadAll does.  It returns the data
+// read and the terminal error, which is nil on a clean io.EOF.  As
+// with WriteTo, an error the io.Reader returned to an earlier Read is
+// returned again after the data buffered before it, and ErrAborted
+// is returned if Close is called.
+func (ar *AsyncReader) Drain() ([]byte, error) {
+	if ar.closed() {
+		return nil, ErrAborted
+	}
+	ar.Start()
+	ar.releaseSegment()
+	data := make([]byte, 0, len(ar.buf)+ar.SizeHint)
+	data = append(data, ar.buf...)
+	ar.buf = ar.buf[:0]
+	ar.consumed(len(data))
+	if ar.err != nil {
+		return data, ar.err
+	}
+	for {
+		select {
+		case <-ar.abort:
+			return data, ErrAborted
+		case s, open := <-ar.c:
+			if !open {
+				return data, nil
+			}
+			data = append(data, s.b...)
+			ar.put(s.b)
+			ar.consumed(len(s.b))
+			if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+				return data, s.err
+			}
+		}
+	}
+}
+
+// NextSegment returns the next buffer read from the io.Reader, for
+// callers that process each segment in turn without needing the
+// stream in a contiguous buffer.  The segment is lent directly from
+// the AsyncReader's pool and is only valid until the next call to
+// NextSegment, Read or Drain, when it is reused; it must not be
+// retained or modified.  Data already buffered by Read is returned
+// first.  Returns io.EOF at completion, or ErrAborted if Close was
+// called.  If the io.Reader fails, all data read before the failure
+// is returned before its error.
+func (ar *AsyncReader) NextSegment() ([]byte, error) {
+	ar.Start()
+	ar.releaseSegment()
+	if len(ar.buf) > 0 {
+		seg := ar.buf
+		ar.buf = nil
+		ar.consumed(len(seg))
+		return seg, nil
+	}
+	if ar.err != nil {
+		return nil, ar.err
+	}
+	for {
+		select {
+		case <-ar.abort:
+			return nil, ErrAborted
+		case s, open := <-ar.c:
+			if !open {
+				return nil, io.EOF
+			}
+			if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+				ar.err = s.err
+			}
+			if len(s.b) == 0 {
+				if ar.err != nil {
+					return nil, ar.err
+				}
+				continue
+			}
+			ar.seg = s.b
+			ar.consumed(len(s.b))
+			return s.b, nil
+		}
+	}
+}
+
+// Returns the segment lent by NextSegment to the pool.
+func (ar *AsyncReader) releaseSegment() {
+	ar.spill()
+	if ar.DebugSegments && ar.dead != nil {
+		for _, c := range ar.dead {
+			if c != 0xa5 {
+				panic("extio: segment written after release")
+			}
+		}
+	}
+	if ar.seg == nil {
+		return
+	}
+	if ar.DebugSegments {
+		for i := range ar.seg {
+			ar.seg[i] = 0xa5
+		}
+		ar.dead = ar.seg
+	} else {
+		ar.put(ar.seg[:cap(ar.seg)])
+	}
+	ar.seg = nil
+}
+
+// Remaining returns the bytes that have been buffered but not yet
+// returned by Read.  The slice is only valid until the next call
+// to Read.
+func (ar *AsyncReader) Remaining() []byte {
+	ar.spill()
+	return ar.buf
+}
+
+// Unwrap stops the buffering goroutine and returns the underlying
+// io.Reader so reading can continue synchronously.  Any data already
+// prefetched from the io.Reader is moved into the buffer returned by
+// Remaining, which must be consumed before reading from the returned
+// io.Reader to preserve the stream's order.  If the prefetch ended
+// with an error other than io.EOF, that error is returned and the
+// io.Reader should not be read further.  After Unwrap, the
+// AsyncReader must not be used concurrently with the io.Reader.
+// If the AsyncReader was never started, the io.Reader is returned
+// unread and the AsyncReader never reads from it.
+func (ar *AsyncReader) Unwrap() (io.Reader, error) {
+	if ar.disarm() {
+		return ar.r, nil
+	}
+	ar.spill()
+	ar.halt()
+	var err error
+	for s := range ar.c {
+		ar.buf = append(ar.buf, s.b...)
+		ar.put(s.b[:cap(s.b)])
+		if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+			err = s.err
+		}
+	}
+	return ar.r, err
+}
+
+// Prevents Start from starting the buffering goroutine, reporting
+// whether it had yet to be started.
+func (ar *AsyncReader) disarm() bool {
+	unstarted := false
+	ar.started.Do(func() {
+		// never start reading from the io.Reader
+		unstarted = true
+		ar.c = make(chan segment)
+		close(ar.c)
+	})
+	return unstarted
+}
+
+// Stops the buffering goroutine once its current read returns.
+func (ar *AsyncReader) halt() {
+	select {
+	case <-ar.stop:
+	default:
+		close(ar.stop)
+	}
+}
+
+// FlushTo stops the buffering goroutine, as Unwrap does, and writes
+// the data already prefetched from the io.Reader to w, along with
+// that of a read in progress, which it waits for, so that data paid
+// for is salvaged when reading stops early.  Data already buffered
+// by Read is written first.  The AsyncReader is then closed, its
+// subsequent Reads returning ErrAborted, but unlike Close, a read in
+// progress is not interrupted, so the io.Reader, such as a net.Conn,
+// remains usable from the end of the data written, as returned by
+// Unwrap.  It returns the number of bytes written and the first
+// error writing to w, or else the error of the io.Reader if the
+// prefetch ended with one other than io.EOF.  Data left once
+// writing to w fails is discarded.
+func (ar *AsyncReader) FlushTo(w io.Writer) (int64, error) {
+	defer ar.shut.Do(func() { close(ar.abort) })
+	ar.disarm()
+	ar.halt()
+	ar.releaseSegment()
+	var (
+		n   int64
+		err = ar.err
+	)
+	write := func(b []byte) error {
+		nn, werr := w.Write(b)
+		n += int64(nn)
+		ar.consumed(nn)
+		if werr == nil && nn < len(b) {
+			werr = io.ErrShortWrite
+		}
+		return werr
+	}
+	var werr error
+	if len(ar.buf) > 0 {
+		werr = write(ar.buf)
+		ar.buf = ar.buf[:0]
+	}
+	for s := range ar.c {
+		if werr == nil {
+			werr = write(s.b)
+		}
+		ar.put(s.b[:cap(s.b)])
+		if s.err != nil && s.err != io.EOF && s.err != io.ErrUnexpectedEOF {
+			err = s.err
+		}
+	}
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
 // Close aborts the buffering goroutine and
-// emits no more data on subsequent Read([]byte) calls
+// emits no more data on subsequent Read([]byte) calls, which
+// return ErrAborted to distinguish the stop from io.EOF.
+// If the io.Reader has a SetReadDeadline method, as a net.Conn
+// does, a deadline in the past is set to interrupt a read in
+// progress so the goroutine and its buffer are freed promptly.
+// Otherwise the goroutine lingers until its current read returns.
+// If called before Start, the io.Reader is never read.  Subsequent
+// calls, and calls after FlushTo, have no effect.
 func (ar *AsyncReader) Close() error {
-	close(ar.abort)
+	ar.shut.Do(func() {
+		close(ar.abort)
+		if d, ok := ar.src.(interface {
+			SetReadDeadline(t time.Time) error
+		}); ok {
+			d.SetReadDeadline(time.Unix(1, 0))
+		}
+	})
 	return nil
 }
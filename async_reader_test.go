@@ -2,11 +2,19 @@ package extio
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	mr "math/rand"
+	"net"
+	"os"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestAsyncReader(t *testing.T) {
@@ -33,6 +41,982 @@ func TestAsyncReader(t *testing.T) {
 
 }
 
+func TestAsyncReaderDoubleBuffer(t *testing.T) {
+
+	for i := 0; i < 200; i++ {
+		buf := make([]byte, 2<<10+mr.Intn(32<<10))
+		rand.Read(buf)
+
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.BufferSize = 1 + mr.Intn(8<<10)
+		ar.DoubleBuffer = true
+		ar.Start()
+
+		data, err := ioutil.ReadAll(ar)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !bytes.Equal(buf, data) {
+			t.Error("buf/data mismatch")
+		}
+
+	}
+
+	// the unread rest of the buffer in use is kept by Unwrap
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	ar := NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 1 << 10
+	ar.DoubleBuffer = true
+	ar.Start()
+
+	head := make([]byte, 1500)
+	if _, err := io.ReadFull(ar, head); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ar.Unwrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := ioutil.ReadAll(io.MultiReader(bytes.NewReader(ar.Remaining()), r))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(buf, append(head, rest...)) {
+		t.Error("buf/data mismatch")
+	}
+
+}
+
+func TestAsyncReaderInvalidSizes(t *testing.T) {
+
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	for _, size := range []int{0, -1} {
+
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.BufferSize = size
+		ar.ChannelSize = size
+		ar.Start()
+
+		done := make(chan []byte, 1)
+		go func() {
+			data, err := ioutil.ReadAll(ar)
+			if err != nil {
+				t.Error(err)
+			}
+			done <- data
+		}()
+
+		select {
+		case data := <-done:
+			if !bytes.Equal(buf, data) {
+				t.Error("buf/data mismatch")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Read hung with sizes of %d", size)
+		}
+
+		if ar.BufferSize != DefaultAsyncBufferSize {
+			t.Errorf("Expected BufferSize %d, got %d", DefaultAsyncBufferSize, ar.BufferSize)
+		}
+
+	}
+
+}
+
+func TestAsyncReaderUnwrap(t *testing.T) {
+
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	ar := NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 1 << 10
+	ar.ChannelSize = 4
+	ar.Start()
+
+	head := make([]byte, 1500)
+	if _, err := io.ReadFull(ar, head); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ar.Unwrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := ioutil.ReadAll(io.MultiReader(bytes.NewReader(ar.Remaining()), r))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(buf, append(head, rest...)) {
+		t.Error("buf/data mismatch")
+	}
+
+}
+
+func TestAsyncReaderFlushTo(t *testing.T) {
+
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	ar := NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 1 << 10
+	ar.ChannelSize = 4
+	ar.Start()
+
+	head := make([]byte, 1500)
+	if _, err := io.ReadFull(ar, head); err != nil {
+		t.Fatal(err)
+	}
+
+	// let the prefetch fill the channel
+	time.Sleep(20 * time.Millisecond)
+
+	var out bytes.Buffer
+	n, err := ar.FlushTo(&out)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != int64(out.Len()) {
+		t.Errorf("Expected %d bytes flushed, got %d", out.Len(), n)
+	}
+	// the rest of the second buffer and a full channel
+	if min := 2*ar.BufferSize - len(head) + ar.ChannelSize*ar.BufferSize; out.Len() < min {
+		t.Errorf("Expected at least %d prefetched bytes, got %d", min, out.Len())
+	}
+
+	data := append(head, out.Bytes()...)
+	if !bytes.Equal(buf[:len(data)], data) {
+		t.Error("buf/data mismatch")
+	}
+
+	if n, err := ar.Read(head); n != 0 || err != ErrAborted {
+		t.Errorf("Expected no data after FlushTo, got %d bytes and %v", n, err)
+	}
+	// as with the usual defer
+	ar.Close()
+	ar.Close()
+
+	// a read in progress is salvaged and the conn left usable
+	src, w := net.Pipe()
+	defer w.Close()
+	ar = NewAsyncReader(src)
+	ar.BufferSize = 4
+	ar.Start()
+	w.Write([]byte("abcd"))
+	go func() {
+		time.Sleep(40 * time.Millisecond)
+		w.Write([]byte("efgh"))
+		w.Write([]byte("ijkl"))
+	}()
+	// let the goroutine block in its next read
+	time.Sleep(20 * time.Millisecond)
+	out.Reset()
+	if _, err := ar.FlushTo(&out); err != nil {
+		t.Error(err)
+	}
+	if out.String() != "abcdefgh" {
+		t.Errorf("Expected %q, got %q", "abcdefgh", out.String())
+	}
+	ar.Close()
+	r, err := ar.Unwrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := make([]byte, 4)
+	if _, err := io.ReadFull(r, rest); err != nil || string(rest) != "ijkl" {
+		t.Errorf("Expected %q, got %q and %v", "ijkl", rest, err)
+	}
+
+}
+
+func TestAsyncReaderReadAfterClose(t *testing.T) {
+
+	for _, double := range []bool{false, true} {
+		pr, pw := io.Pipe()
+		ar := NewAsyncReader(pr)
+		ar.BufferSize = 4
+		ar.DoubleBuffer = double
+		ar.Start()
+
+		pw.Write([]byte("data"))
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(ar, buf); err != nil {
+			t.Fatal(err)
+		}
+
+		// a Read blocked waiting for data is interrupted
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			ar.Close()
+		}()
+		big := make([]byte, 8)
+		if n, err := ar.Read(big); n != 0 || err != ErrAborted {
+			t.Errorf("double %v: Expected %q, got %d bytes and %v", double, ErrAborted, n, err)
+		}
+		for i := 0; i < 3; i++ {
+			if n, err := ar.Read(buf); n != 0 || err != ErrAborted {
+				t.Errorf("double %v: Expected %q, got %d bytes and %v", double, ErrAborted, n, err)
+			}
+		}
+		pw.Close()
+	}
+
+}
+
+func TestAsyncReaderWriteTo(t *testing.T) {
+
+	testError := errors.New("test")
+
+	good := make([]byte, 10<<10+100)
+	rand.Read(good)
+
+	for _, double := range []bool{false, true} {
+		ar := NewAsyncReader(bytes.NewReader(good))
+		ar.BufferSize = 1 << 10
+		ar.DoubleBuffer = double
+		ar.Start()
+
+		// data already buffered by Read is written first
+		head := make([]byte, 1500)
+		if _, err := io.ReadFull(ar, head); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		n, err := io.Copy(&out, ar)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != int64(len(good)-len(head)) || !bytes.Equal(append(head, out.Bytes()...), good) {
+			t.Errorf("double %v: data mismatch, %d bytes written", double, n)
+		}
+	}
+
+	// data read before an error is written before it
+	ar := NewAsyncReader(io.MultiReader(bytes.NewReader(good), &errorReader{err: testError}))
+	ar.BufferSize = 1 << 10
+	ar.Start()
+	var out bytes.Buffer
+	if n, err := ar.WriteTo(&out); err != testError || n != int64(len(good)) {
+		t.Errorf("Expected %d bytes and %q, got %d and %v", len(good), testError, n, err)
+	}
+	if !bytes.Equal(out.Bytes(), good) {
+		t.Error("data mismatch before error")
+	}
+	if _, err := ar.WriteTo(&out); err != testError {
+		t.Errorf("Expected %q, got %q", testError, err)
+	}
+
+	// Close interrupts a WriteTo waiting for data
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	ar = NewAsyncReader(pr)
+	ar.BufferSize = 4
+	ar.Start()
+	go func() {
+		pw.Write([]byte("data"))
+		time.Sleep(10 * time.Millisecond)
+		ar.Close()
+	}()
+	out.Reset()
+	if n, err := ar.WriteTo(&out); err != ErrAborted || n != 4 {
+		t.Errorf("Expected 4 bytes and %q, got %d and %v", ErrAborted, n, err)
+	}
+
+}
+
+func TestAsyncReaderLazyStart(t *testing.T) {
+
+	// Read starts an AsyncReader never started
+	ar := NewAsyncReader(bytes.NewReader(data))
+	out, err := ioutil.ReadAll(ar)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("data mismatch")
+	}
+
+	// a second Start has no effect
+	ar = NewAsyncReader(bytes.NewReader(data))
+	ar.Start()
+	c := ar.c
+	ar.Start()
+	if ar.c != c {
+		t.Error("Start replaced the channel")
+	}
+	if out, err = ioutil.ReadAll(ar); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("data mismatch after second Start: %v", err)
+	}
+
+	// Close before Start reads nothing
+	r := bytes.NewReader(data)
+	ar = NewAsyncReader(r)
+	ar.Close()
+	if n, err := ar.Read(make([]byte, 10)); n != 0 || err != ErrAborted {
+		t.Errorf("Expected %q, got %d bytes and %v", ErrAborted, n, err)
+	}
+	ar.Start()
+	if _, err := ar.NextSegment(); err != ErrAborted && err != io.EOF {
+		t.Errorf("Expected %q or %q, got %v", ErrAborted, io.EOF, err)
+	}
+	if r.Len() != len(data) {
+		t.Errorf("Expected the io.Reader unread, %d bytes read", len(data)-r.Len())
+	}
+
+	// Unwrap before Start leaves the io.Reader to the caller
+	r = bytes.NewReader(data)
+	ar = NewAsyncReader(r)
+	if u, err := ar.Unwrap(); u != r || err != nil {
+		t.Errorf("Expected the io.Reader, got %v and %v", u, err)
+	}
+	if _, err := ar.Read(make([]byte, 10)); err != io.EOF || r.Len() != len(data) {
+		t.Errorf("Expected %q and the io.Reader unread, got %v", io.EOF, err)
+	}
+
+}
+
+func TestAsyncReaderBytesRead(t *testing.T) {
+
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	ar := NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 1 << 10
+	ar.ChannelSize = 4
+	ar.Start()
+
+	// polled while reading
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ar.BytesRead() < int64(len(buf)) {
+			if n := ar.BytesRead() + int64(ar.BytesBuffered()); n > int64(len(buf)) {
+				t.Errorf("Expected at most %d bytes, got %d", len(buf), n)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	p := make([]byte, 100)
+	if _, err := io.ReadFull(ar, p); err != nil {
+		t.Fatal(err)
+	}
+	// let the prefetch fill the channel
+	time.Sleep(20 * time.Millisecond)
+	if n := ar.BytesRead(); n != 100 {
+		t.Errorf("Expected 100 bytes read, got %d", n)
+	}
+	if n, min := ar.BytesBuffered(), ar.ChannelSize*ar.BufferSize; n < min {
+		t.Errorf("Expected at least %d bytes buffered, got %d", min, n)
+	}
+
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, ar); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if n := ar.BytesRead(); n != int64(len(buf)) {
+		t.Errorf("Expected %d bytes read, got %d", len(buf), n)
+	}
+	if n := ar.BytesBuffered(); n != 0 {
+		t.Errorf("Expected nothing buffered, got %d", n)
+	}
+
+}
+
+func TestAsyncReaderMaxPrefetchBytes(t *testing.T) {
+
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	for _, test := range []struct {
+		limit, expected int
+		minSegment      int
+	}{
+		{3 << 10, 3 << 10, 0},
+		{3<<10 + 100, 3 << 10, 0},
+		{100, 1 << 10, 0}, // one buffer at a time
+		{3 << 10, 3 << 10, 1 << 10},
+	} {
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.BufferSize = 1 << 10
+		ar.MinSegment = test.minSegment
+		ar.MaxPrefetchBytes = test.limit
+		ar.Start()
+
+		// let the prefetch reach the limit
+		time.Sleep(20 * time.Millisecond)
+		if n := ar.BytesBuffered(); n != test.expected {
+			t.Errorf("limit %d: Expected %d bytes buffered, got %d", test.limit, test.expected, n)
+		}
+
+		// resumes as reads drain it, reading a buffer when none is
+		// queued beside the rest of one partly read
+		head := make([]byte, 1500)
+		if _, err := io.ReadFull(ar, head); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n := ar.BytesBuffered(); n > test.expected+ar.BufferSize || n < test.expected-ar.BufferSize {
+			t.Errorf("limit %d: Expected about %d bytes buffered, got %d", test.limit, test.expected, n)
+		}
+
+		rest, err := ioutil.ReadAll(ar)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(append(head, rest...), buf) {
+			t.Errorf("limit %d: data mismatch", test.limit)
+		}
+	}
+
+}
+
+func TestAsyncTeeReader(t *testing.T) {
+
+	buf := make([]byte, 64<<10)
+	rand.Read(buf)
+
+	var (
+		mu   sync.Mutex
+		tee  bytes.Buffer
+		full = make(chan struct{})
+	)
+
+	ar := NewAsyncTeeReader(bytes.NewReader(buf), writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		tee.Write(p)
+		if tee.Len() == len(buf) {
+			close(full)
+		}
+		return len(p), nil
+	}))
+	ar.BufferSize = 1 << 10
+	ar.ChannelSize = 64
+	ar.Start()
+
+	// tee has the whole source before the consumer reads any
+	select {
+	case <-full:
+	case <-time.After(time.Second):
+		t.Fatal("tee did not receive the source")
+	}
+	if !bytes.Equal(tee.Bytes(), buf) {
+		t.Error("tee data mismatch")
+	}
+
+	out, err := ioutil.ReadAll(ar)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(out, buf) {
+		t.Error("data mismatch")
+	}
+
+	// a failed Write to tee is returned after the data before it
+	testError := errors.New("test")
+	written := 0
+	ar = NewAsyncTeeReader(bytes.NewReader(buf), writerFunc(func(p []byte) (int, error) {
+		if written+len(p) > 10<<10 {
+			return 0, testError
+		}
+		written += len(p)
+		return len(p), nil
+	}))
+	ar.BufferSize = 1 << 10
+	out, err = ioutil.ReadAll(ar)
+	if err != testError {
+		t.Errorf("Expected %q, got %v", testError, err)
+	}
+	if !bytes.Equal(out, buf[:len(out)]) || len(out) < written {
+		t.Errorf("Expected at least %d bytes of the source, got %d", written, len(out))
+	}
+
+}
+
+func TestAsyncReaderUnwrapError(t *testing.T) {
+
+	testError := errors.New("test")
+
+	ar := NewAsyncReader(&errorReader{err: testError})
+	ar.Start()
+
+	// wait for the failed read to be prefetched
+	for len(ar.c) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := ar.Unwrap(); err != testError {
+		t.Errorf("Expected %q, got %q", testError, err)
+	}
+
+}
+
+func TestAsyncReaderCloseDeadline(t *testing.T) {
+
+	src, w := net.Pipe()
+	defer w.Close()
+
+	ar := NewAsyncReader(src)
+	ar.Start()
+
+	// the goroutine blocks reading from the idle pipe
+	w.Write([]byte("partial"))
+	ar.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for range ar.c {
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not interrupt the blocked read")
+	}
+
+}
+
+func TestAsyncReaderErrorAfterData(t *testing.T) {
+
+	testError := errors.New("test")
+
+	good := make([]byte, 10<<10+100)
+	rand.Read(good)
+
+	ar := NewAsyncReader(io.MultiReader(bytes.NewReader(good), &errorReader{err: testError}))
+	ar.BufferSize = 1 << 10
+	ar.Start()
+
+	var (
+		out []byte
+		err error
+		p   = make([]byte, 3000)
+	)
+	for err == nil {
+		var n int
+		n, err = ar.Read(p)
+		out = append(out, p[:n]...)
+	}
+
+	if err != testError {
+		t.Errorf("Expected %q, got %q", testError, err)
+	}
+	if !bytes.Equal(out, good) {
+		t.Errorf("Expected %d good bytes before the error, got %d", len(good), len(out))
+	}
+
+	if _, err := ar.Read(p); err != testError {
+		t.Errorf("Expected %q on subsequent Read, got %q", testError, err)
+	}
+
+}
+
+func TestAsyncReaderNextSegment(t *testing.T) {
+
+	buf := make([]byte, 64<<10+100)
+	rand.Read(buf)
+
+	ar := NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 1 << 10
+	ar.DebugSegments = true
+	ar.Start()
+
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(ar, head); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		out  = head
+		prev []byte
+	)
+	for i := 0; ; i++ {
+		seg, err := ar.NextSegment()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the first segment is the remainder buffered by Read
+		if i > 1 && prev[0] != 0xa5 {
+			t.Error("Expected released segment to be poisoned")
+		}
+		out = append(out, seg...)
+		prev = seg
+	}
+
+	if !bytes.Equal(out, buf) {
+		t.Error("buf/data mismatch")
+	}
+
+	// writing to a released segment is detected
+	ar = NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 1 << 10
+	ar.DebugSegments = true
+	ar.Start()
+
+	seg, _ := ar.NextSegment()
+	ar.NextSegment()
+	seg[0] = 0
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on segment written after release")
+		}
+	}()
+	ar.NextSegment()
+
+}
+
+func TestAsyncReaderSegmentWindow(t *testing.T) {
+
+	buf := make([]byte, 1050)
+	rand.Read(buf)
+
+	segments := func(ar *AsyncReader) ([]int, []byte) {
+		var (
+			sizes []int
+			out   []byte
+		)
+		for {
+			seg, err := ar.NextSegment()
+			if err == io.EOF {
+				return sizes, out
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sizes = append(sizes, len(seg))
+			out = append(out, seg...)
+		}
+	}
+
+	// a source faster than MinSegment is delivered in MinSegment
+	// sized segments, with the remainder at EOF
+	ar := NewAsyncReader(iotest.OneByteReader(bytes.NewReader(buf)))
+	ar.MinSegment = 100
+	ar.Start()
+
+	sizes, out := segments(ar)
+	if !bytes.Equal(out, buf) {
+		t.Error("buf/data mismatch")
+	}
+	for i, n := range sizes {
+		if want := 100; i == len(sizes)-1 {
+			if n != 50 {
+				t.Errorf("Expected final segment of 50, got %d", n)
+			}
+		} else if n != want {
+			t.Errorf("Expected segment %d of %d, got %d", i, want, n)
+		}
+	}
+
+	// no segment exceeds MaxSegment
+	ar = NewAsyncReader(bytes.NewReader(buf))
+	ar.MinSegment = 100
+	ar.MaxSegment = 400
+	ar.Start()
+
+	sizes, out = segments(ar)
+	if !bytes.Equal(out, buf) {
+		t.Error("buf/data mismatch")
+	}
+	if want := []int{400, 400, 250}; fmt.Sprint(sizes) != fmt.Sprint(want) {
+		t.Errorf("Expected segments %v, got %v", want, sizes)
+	}
+
+	// a source slower than MinSegment is delivered when idle
+	pr, pw := io.Pipe()
+	ar = NewAsyncReader(pr)
+	ar.MinSegment = 100
+	ar.IdleTimeout = 20 * time.Millisecond
+	ar.Start()
+	defer ar.Close()
+
+	go pw.Write(buf[:10])
+
+	start := time.Now()
+	seg, err := ar.NextSegment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(seg, buf[:10]) {
+		t.Error("buf/data mismatch")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected delivery after %s idle, took %s", ar.IdleTimeout, d)
+	}
+	pw.Close()
+
+}
+
+type failOnceReader struct {
+	*bytes.Reader
+	at     int64
+	failed bool
+}
+
+// Read returns part of a read and an error the first time the
+// offset at is reached, leaving the io.Reader past the bytes
+// returned as a failed read might.
+func (r *failOnceReader) Read(b []byte) (int, error) {
+	off := r.Size() - int64(r.Len())
+	if !r.failed && off+int64(len(b)) > r.at {
+		r.failed = true
+		n, _ := r.Reader.Read(b[:r.at-off])
+		r.Reader.Seek(100, io.SeekCurrent)
+		return n, errors.New("transient")
+	}
+	return r.Reader.Read(b)
+}
+
+func TestAsyncReaderRetry(t *testing.T) {
+
+	buf := make([]byte, 64<<10+100)
+	rand.Read(buf)
+
+	ar := NewAsyncReader(&failOnceReader{Reader: bytes.NewReader(buf), at: 5000})
+	ar.BufferSize = 1 << 10
+	ar.RetryLimit = 1
+	ar.RetryBackoff = time.Millisecond
+	ar.Start()
+
+	out, err := ar.Drain()
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(out, buf) {
+		t.Error("buf/data mismatch")
+	}
+
+	// without retries the error is returned
+	ar = NewAsyncReader(&failOnceReader{Reader: bytes.NewReader(buf), at: 5000})
+	ar.BufferSize = 1 << 10
+	ar.Start()
+
+	out, err = ar.Drain()
+	if err == nil || err.Error() != "transient" {
+		t.Errorf("Expected transient error, got %v", err)
+	}
+	if !bytes.Equal(out, buf[:5000]) {
+		t.Errorf("Expected %d bytes before the error, got %d", 5000, len(out))
+	}
+
+}
+
+func TestAsyncReaderIdleFlush(t *testing.T) {
+
+	pr, pw := io.Pipe()
+
+	ar := NewAsyncReader(pr)
+	ar.BufferSize = 1 << 10
+	ar.IdleFlush = 20 * time.Millisecond
+	ar.Start()
+
+	// each burst is delivered during the gap that follows it
+	go func() {
+		for _, burst := range []string{"first burst", "second"} {
+			pw.Write([]byte(burst))
+			time.Sleep(100 * time.Millisecond)
+		}
+		pw.Close()
+	}()
+
+	// a burst joined with the next was held for a full buffer
+	start := time.Now()
+	for _, burst := range []string{"first burst", "second"} {
+		seg, err := ar.NextSegment()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(seg) != burst {
+			t.Errorf("Expected %q, got %q", burst, seg)
+		}
+		if d := time.Since(start); d > 90*time.Millisecond {
+			t.Errorf("Expected delivery within %s of the burst, took %s", ar.IdleFlush, d)
+		}
+		start = start.Add(100 * time.Millisecond)
+	}
+
+	if _, err := ar.NextSegment(); err != io.EOF {
+		t.Errorf("Expected %q, got %q", io.EOF, err)
+	}
+
+}
+
+func TestAsyncReaderSetReadDeadline(t *testing.T) {
+
+	pr, pw := io.Pipe()
+
+	ar := NewAsyncReader(pr)
+	ar.BufferSize = 4
+	ar.Start()
+
+	buf := make([]byte, 4)
+
+	// the source pauses
+	ar.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if n, err := ar.Read(buf); n != 0 || err != os.ErrDeadlineExceeded {
+		t.Errorf("Expected %q, got %d bytes and %v", os.ErrDeadlineExceeded, n, err)
+	}
+
+	// and resumes
+	go pw.Write([]byte("more"))
+	ar.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := ar.Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != "more" {
+		t.Errorf("Expected %q, got %q", "more", buf[:n])
+	}
+
+	// the end of the stream takes precedence
+	pw.Close()
+	ar.SetReadDeadline(time.Now().Add(-time.Second))
+	time.Sleep(10 * time.Millisecond)
+	if _, err := ar.Read(buf); err != io.EOF {
+		t.Errorf("Expected %q, got %q", io.EOF, err)
+	}
+
+}
+
+func TestAsyncReaderDrain(t *testing.T) {
+
+	buf := make([]byte, 2<<20+mr.Intn(32<<10))
+	rand.Read(buf)
+
+	ar := NewAsyncReader(bytes.NewReader(buf))
+	ar.BufferSize = 64 << 10
+	ar.Start()
+
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(ar, head); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ar.Drain()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(buf, append(head, data...)) {
+		t.Error("buf/data mismatch")
+	}
+
+	// an error already received by Read is returned after the data
+	// buffered before it
+	testError := errors.New("test")
+	good := buf[:3<<10]
+	ar = NewAsyncReader(io.MultiReader(bytes.NewReader(good), &errorReader{err: testError}))
+	ar.BufferSize = 2 << 10
+	ar.Start()
+	head = make([]byte, 2<<10+100)
+	if _, err := io.ReadFull(ar, head); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ar.Drain()
+	if err != testError {
+		t.Errorf("Expected %q, got %v", testError, err)
+	}
+	if !bytes.Equal(good, append(head, data...)) {
+		t.Error("data mismatch before error")
+	}
+
+	ar.Close()
+	if _, err := ar.Drain(); err != ErrAborted {
+		t.Errorf("Expected %q, got %v", ErrAborted, err)
+	}
+
+}
+
+func TestAsyncReaderAutoDecompress(t *testing.T) {
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	for _, input := range [][]byte{data, gz.Bytes(), data[:1], {}} {
+
+		ar := NewAsyncReader(bytes.NewReader(input))
+		ar.BufferSize = 1 << 10
+		ar.AutoDecompress = true
+		ar.Start()
+
+		out, err := ioutil.ReadAll(ar)
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := input
+		if len(input) == gz.Len() {
+			expected = data
+		}
+		if !bytes.Equal(out, expected) {
+			t.Errorf("Expected %d bytes, got %d", len(expected), len(out))
+		}
+
+	}
+
+	// bzip2 -9 of bzip2Plain
+	var (
+		bzip2Plain = []byte("extio bzip2 fixture\nextio bzip2 fixture\n")
+		bzip2Data  = []byte{
+			0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x03, 0x12,
+			0x4f, 0xfe, 0x00, 0x00, 0x06, 0xd9, 0x80, 0x00, 0x10, 0x40, 0x00, 0x10,
+			0x00, 0x13, 0x20, 0xd6, 0x50, 0x20, 0x00, 0x31, 0x00, 0x00, 0x02, 0xaa,
+			0x4d, 0x3c, 0xa0, 0xf5, 0x3c, 0xa4, 0x3b, 0x43, 0xc4, 0xbd, 0x74, 0xda,
+			0x98, 0xa7, 0xc5, 0xb0, 0x95, 0xa1, 0x8f, 0xc5, 0xdc, 0x91, 0x4e, 0x14,
+			0x24, 0x00, 0xc4, 0x93, 0xff, 0x80,
+		}
+	)
+
+	for _, input := range [][]byte{bzip2Data, bzip2Plain} {
+
+		ar := NewAsyncReader(bytes.NewReader(input))
+		ar.AutoDecompress = true
+		ar.Start()
+
+		out, err := ioutil.ReadAll(ar)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(out, bzip2Plain) {
+			t.Errorf("Expected %q, got %q", bzip2Plain, out)
+		}
+
+	}
+
+	// unknown compression method
+	bad := append([]byte{}, gz.Bytes()...)
+	bad[2] = 0
+
+	ar := NewAsyncReader(bytes.NewReader(bad))
+	ar.AutoDecompress = true
+	ar.Start()
+
+	if _, err := ioutil.ReadAll(ar); err != gzip.ErrHeader {
+		t.Errorf("Expected %q, got %q", gzip.ErrHeader, err)
+	}
+
+}
+
 func BenchmarkReader(b *testing.B) {
 	buf := make([]byte, 8<<20)
 	b.SetBytes(int64(len(buf)))
@@ -53,3 +1037,57 @@ func BenchmarkAsyncReader(b *testing.B) {
 		io.Copy(ioutil.Discard, ar)
 	}
 }
+
+func BenchmarkAsyncReaderDoubleBuffer(b *testing.B) {
+	buf := make([]byte, 8<<20)
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.DoubleBuffer = true
+		ar.Start()
+		io.Copy(ioutil.Discard, ar)
+	}
+}
+
+func BenchmarkAsyncReaderReadAll(b *testing.B) {
+	buf := make([]byte, 8<<20)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.Start()
+		ioutil.ReadAll(ar)
+	}
+}
+
+func BenchmarkAsyncReaderNextSegment(b *testing.B) {
+	buf := make([]byte, 8<<20)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.Start()
+		for {
+			seg, err := ar.NextSegment()
+			if err != nil {
+				break
+			}
+			ioutil.Discard.Write(seg)
+		}
+	}
+}
+
+func BenchmarkAsyncReaderDrain(b *testing.B) {
+	buf := make([]byte, 8<<20)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ar := NewAsyncReader(bytes.NewReader(buf))
+		ar.Start()
+		ar.Drain()
+	}
+}
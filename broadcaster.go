@@ -1,6 +1,18 @@
 package extio
 
-import "io"
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type (
 	// A Broadcaster takes a single io.Reader and broadcasts
@@ -20,20 +32,400 @@ type (
 		// not be set after calling Broadcast(). (default: 32kb)
 		ReadBufferSize int
 
-		brs   []*BroadcasterReader
-		abort chan struct{}
+		// SlowReaderTimeout is the longest Broadcast will block
+		// sending to a single BroadcasterReader.  A reader that
+		// is not consumed within this window is removed from the
+		// broadcast and its subsequent reads return a
+		// *ReaderDroppedError, which wraps ErrReaderTimedOut, once
+		// its buffered data is exhausted.  Under LockStep, a reader
+		// that has not received a segment within this window is
+		// dropped likewise, and the segment is discarded for it.
+		// Readers created with NewUnbufferedSafeReader never block
+		// the broadcast, and readers with a positive priority are
+		// exempt, see SetPriority.  Zero blocks indefinitely.
+		// (default: 0)
+		SlowReaderTimeout time.Duration
+
+		// Backpressure selects how the broadcast treats a reader
+		// whose channel is full.  BlockAll waits for it, so that no
+		// reader loses data.  DropSlow discards the segment for it,
+		// while DropOldest discards the oldest segment it has queued
+		// to make room for the new one, favoring current data, as
+		// for live telemetry.  A reader may detect the gaps with
+		// Dropped.  The policy applies to readers of NewReader
+		// alone, as readers of NewUnbufferedSafeReader never fill,
+		// and those of AutoTuneReadChan grow their queue instead.
+		// This must not be set after calling Broadcast().
+		// (default: BlockAll)
+		Backpressure BackpressurePolicy
+
+		// ErrorPolicy, if set, is called with each error other
+		// than io.EOF returned by the io.Reader and decides how
+		// the Broadcaster handles it.  This allows retrying reads
+		// from sources that emit transient errors.  Each ignored
+		// error is followed immediately by another read, so the
+		// policy must bound its retries, or back off itself, to
+		// avoid spinning on a source that keeps failing.  When nil,
+		// all errors are propagated. (default: nil)
+		ErrorPolicy func(err error) ErrorAction
+
+		// SustainedBytesPerSec limits the long term rate at which
+		// the io.Reader is read, while BurstBytes allows reading
+		// up to that many bytes at once when the rate has been
+		// under the limit.  Together they form a token bucket,
+		// letting several broadcasts share a source fairly.  Zero
+		// disables the limit.  BurstBytes defaults to ReadBufferSize
+		// when zero.  These must not be set after calling Broadcast().
+		// (default: 0)
+		SustainedBytesPerSec int
+		BurstBytes           int
+
+		// MaxInFlightBuffers bounds the number of buffers read from
+		// the io.Reader that have not yet been received by every
+		// BroadcasterReader.  When the limit is reached, reading from
+		// the io.Reader pauses until a buffer is released, so the
+		// memory held by the broadcast is at most about
+		// MaxInFlightBuffers * ReadBufferSize regardless of the number
+		// of readers or ReadChanLength.  The limit applies backpressure
+		// even to readers created with NewUnbufferedSafeReader.  Zero
+		// disables the limit.  This must not be set after calling Broadcast(). (default: 0)
+		MaxInFlightBuffers int
+
+		// UseWriterTo, when the io.Reader implements io.WriterTo,
+		// drives the broadcast by calling its WriteTo method rather
+		// than reading from it in a loop.  Each write is split into
+		// ReadBufferSize segments and sent to the BroadcasterReaders
+		// as they are written.  This lets sources such as
+		// *bytes.Reader, which hold their data in memory, hand it
+		// over in large writes rather than a read per segment.
+		// Errors from WriteTo are not passed to ErrorPolicy, and the
+		// pull loop is used regardless when SustainedBytesPerSec is
+		// set.  Abort interrupts WriteTo at its next write, which
+		// returns ErrAborted.  WriteTo is used without UseWriterTo
+		// when the io.Reader is a *bytes.Reader, *strings.Reader or
+		// *bytes.Buffer, ErrorPolicy is nil and SustainedBytesPerSec
+		// is zero, as such sources hold their data in memory and
+		// never fail.  It is not the default for other io.Readers
+		// as many, such as *os.File and *net.TCPConn, implement
+		// io.WriterTo without holding their data in memory, and
+		// would bypass ErrorPolicy and ReplaceSource. (default: false)
+		UseWriterTo bool
+
+		// LockStep makes the Broadcaster wait until every
+		// BroadcasterReader has received a segment before sending
+		// the next, so no reader is ever more than one segment
+		// ahead of another.  This suits consumers that process the
+		// same position of the stream together, at the cost of
+		// running the whole broadcast at the pace of the slowest
+		// reader with no read ahead.  This must not be set after
+		// calling Broadcast(). (default: false)
+		LockStep bool
+
+		// PerReaderCopy sends each BroadcasterReader its own copy
+		// of every segment rather than sharing one slice between
+		// them, so the buffer read from the io.Reader is reused as
+		// soon as the segment is sent.  This costs a copy per reader
+		// but decouples the readers' memory from each other and from
+		// the source, which favors few readers over many.  This must
+		// not be set after calling Broadcast(). (default: false)
+		PerReaderCopy bool
+
+		// AutoTuneReadChan adapts the number of segments each
+		// BroadcasterReader may queue to how it keeps up.  A reader
+		// whose queue is repeatedly full has it doubled, up to
+		// MaxReadChanLength, while a reader whose queue repeatedly
+		// empties has it halved, down to one.  Queues start at
+		// ReadChanLength.  This must be set before calling
+		// NewReader(). (default: false)
+		AutoTuneReadChan bool
+		// MaxReadChanLength bounds the queue of a BroadcasterReader
+		// under AutoTuneReadChan.  Values less than ReadChanLength
+		// are treated as 8 * ReadChanLength. (default: 0)
+		MaxReadChanLength int
+
+		// MaxReaderBacklog, if greater than zero, bounds the bytes
+		// broadcast to a single BroadcasterReader that it has yet
+		// to read.  A reader that would exceed it is removed from
+		// the broadcast, the data queued for it is discarded, and
+		// its next Read returns ErrBacklogExceeded.  Readers of
+		// NewReader already hold at most ReadChanLength segments,
+		// applying backpressure instead once full, so this only
+		// affects them when less than ReadChanLength *
+		// ReadBufferSize.  It chiefly bounds the memory of readers
+		// of NewUnbufferedSafeReader and AutoTuneReadChan, whose
+		// queues otherwise grow with how far they fall behind.
+		// (default: 0)
+		MaxReaderBacklog int
+
+		// MinReaders, if greater than zero, makes Broadcast wait
+		// before its first read from the io.Reader until at least
+		// this many BroadcasterReaders have been created, so that
+		// consumers connecting concurrently with Broadcast all
+		// receive the stream from its start.  Abort interrupts the
+		// wait. (default: 0)
+		MinReaders int
+
+		// Metrics receives measurements of the broadcast as it
+		// runs, so that it may be observed with a metrics library
+		// without this package depending on it.  See Metrics for
+		// when each method is called.  Nil is treated as
+		// NopMetrics.  This must not be set after calling
+		// Broadcast(). (default: NopMetrics)
+		Metrics Metrics
+
+		// Hash, if set, is written every segment broadcast, so that
+		// once the io.Reader reaches EOF each BroadcasterReader that
+		// has read the whole stream may retrieve the checksum of the
+		// source with Checksum, such as to write it as a trailer
+		// after the data.  This must not be set after calling
+		// Broadcast(). (default: nil)
+		Hash hash.Hash
+
+		// VerifyMode checks the guarantee that every reader receives
+		// the same segments, in order, as a debugging aid for tests
+		// of the Broadcaster and of pipelines built on it.  Each
+		// segment is numbered as it is broadcast, and a
+		// BroadcasterReader that receives one out of order, twice,
+		// or after a gap, fails with a *SequenceError and is closed.
+		// Readers verify the segments they receive from when they
+		// join, in Read and ReadContext, and those of
+		// NewChannelReader before sending them, reporting the error
+		// as the terminal error.  Gaps are not reported under a
+		// Backpressure other than BlockAll, which discards segments
+		// by design.  This must not be set after calling
+		// Broadcast(). (default: false)
+		VerifyMode bool
+
+		bucket   *tokenBucket
+		spare    []byte    // reused by PerReaderCopy
+		bufs     sync.Pool // released *broadcastBuffers
+		inflight chan struct{}
+		closing  chan struct{} // signaled by BroadcasterReader.Close
+
+		brs       []*BroadcasterReader // written by broadcast under mu
+		counters  []*CountingReader
+		total     int64 // bytes broadcast
+		progress  func(total int64)
+		every     int64 // bytes between calls to progress
+		reported  int64 // total at the last call to progress
+		abort     chan struct{}
+		abortOnce sync.Once
+		abortErr  error // set by AbortWithError before abort is closed
+
+		pumps sync.WaitGroup
+
+		seq uint64 // of the last segment, under VerifyMode
+
+		mu      sync.Mutex
+		pumpErr error
+		status  BroadcastStatus
+		err     error
+		next    io.Reader // set by ReplaceSource
+		replace int32     // set when next is pending
+		joining []*BroadcasterReader
+		resort  int32 // set when brs must be sorted by priority
+		nextID  int
+		ended   bool
+		endErr  error
+		sum     []byte // of Hash at EOF
+		running bool
+		gate    chan struct{} // set by Pause, closed by Resume
+		added   chan struct{} // closed by add, if set
+		served  int           // readers joined, for Stats
+		dropped int           // readers dropped, for Stats
+		paused  int32         // set while gate is pending
 	}
 
 	// A BroadcasterReader satisfies the io.ReadCloser interface
 	// and receives it's bytes from the Broadcaster's io.Reader
 	BroadcasterReader struct {
+		id       int
 		b        *Broadcaster
 		buf      []byte
-		data     chan []byte
+		data     chan *broadcastBuffer
+		in       chan *broadcastBuffer // broadcast side of data
 		err      chan error
 		shutdown chan struct{}
+		closed   sync.Once
 		last     error
+		limit    int32 // queue length under AutoTuneReadChan
+		priority int32
+		n        int64     // bytes returned by Read
+		backlog  int64     // bytes sent but not yet received by Read
+		exceeded int32     // set once MaxReaderBacklog is exceeded
+		dropped  int64     // bytes discarded by Backpressure
+		pump     io.Writer // set by NewReaderToWriter
+		closer   io.Closer // set by NewReaderFrom
+		snapshot io.Reader // set by NewReaderWithSnapshot, until EOF
+		pumpErr  error     // of the copy to pump
+
+		deadline atomic.Value // time.Time set by SetReadDeadline
+
+		next      uint64 // seq expected under VerifyMode, if not zero
+		verifyErr error  // a *SequenceError, once verification fails
+
+		// segments sent but not yet received, when queued by queue
+		// rather than held by data alone
+		queued int64
+	}
+
+	// A BroadcastRunResult details the outcome of BroadcastToDetailed.
+	BroadcastRunResult struct {
+		// Source is the error of the broadcast itself, as returned
+		// by Broadcast had no io.Writer failed.
+		Source error
+		// Writers holds the error of each io.Writer, in the order
+		// given, or nil for those that succeeded.
+		Writers []error
+	}
+
+	// Stats describes a broadcast, as returned by BroadcastStats.
+	Stats struct {
+		// BytesRead is the number of bytes read from the io.Reader.
+		BytesRead int64
+		// Elapsed is the duration of the broadcast.
+		Elapsed time.Duration
+		// ReadersServed is the number of BroadcasterReaders that
+		// took part in the broadcast, including those that closed
+		// or were dropped.
+		ReadersServed int
+		// ReadersDropped is the number of BroadcasterReaders
+		// removed from the broadcast for exceeding SlowReaderTimeout
+		// or MaxReaderBacklog.
+		ReadersDropped int
+	}
+
+	// A SequenceError is returned by the reads of a
+	// BroadcasterReader that received a segment out of sequence
+	// under VerifyMode.
+	SequenceError struct {
+		// ID is the ID of the BroadcasterReader.
+		ID int
+		// Expected is the number of the segment expected.
+		Expected uint64
+		// Got is the number of the segment received.
+		Got uint64
+	}
+
+	// A ReaderDroppedError is returned by the reads of a
+	// BroadcasterReader removed from the broadcast for exceeding
+	// SlowReaderTimeout, describing how far behind it was.
+	ReaderDroppedError struct {
+		// ID is the ID of the BroadcasterReader.
+		ID int
+		// Queued is the number of segments the BroadcasterReader
+		// had yet to read when it was dropped, not counting the
+		// one it failed to accept.
+		Queued int
+		// Waited is how long the broadcast waited for it.
+		Waited time.Duration
+	}
+
+	// Metrics is implemented by the receiver of a Broadcaster's
+	// measurements, as set by its Metrics field.  Its methods are
+	// called from the goroutine running Broadcast, never
+	// concurrently, in the path of every segment, so they must be
+	// cheap and must not block, or they slow the whole broadcast.
+	// Implementations that aggregate elsewhere should do no more
+	// than update counters or gauges.
+	Metrics interface {
+		// RecordRead is called with the size of each segment read
+		// from the io.Reader, before it is sent to the readers.
+		RecordRead(n int)
+		// RecordReaderLag is called with the ID of each
+		// BroadcasterReader after every segment is sent to it, and
+		// the number of segments queued for it that it has yet to
+		// read, so once per reader per segment.
+		RecordReaderLag(id int, n int)
+		// RecordDrop is called with the ID of a BroadcasterReader
+		// once, when it is removed from the broadcast for exceeding
+		// SlowReaderTimeout or MaxReaderBacklog.
+		RecordDrop(id int)
 	}
+
+	// NopMetrics is a Metrics that discards its measurements.
+	NopMetrics struct{}
+
+	// broadcastWriter is the io.Writer passed to the WriteTo
+	// method of the io.Reader when UseWriterTo is set.
+	broadcastWriter struct {
+		b *Broadcaster
+	}
+
+	// A broadcastBuffer is a single read from the io.Reader shared
+	// by all BroadcasterReaders.  refs counts the readers that have
+	// yet to receive it, plus one held by the Broadcaster while
+	// sending.  Readers copy the data out before releasing their
+	// reference, so once refs reaches zero the buffer is returned
+	// to the Broadcaster's pool for reuse.
+	broadcastBuffer struct {
+		data []byte
+		refs int32
+		done chan struct{} // closed when refs reaches zero, if LockStep
+		seq  uint64        // of the segment, under VerifyMode
+
+		// parent is the buffer this is a PerReaderCopy of, which
+		// holds the references for all of its copies
+		parent *broadcastBuffer
+	}
+
+	// A CountingReader participates in a broadcast by counting
+	// the bytes broadcast, without receiving or buffering them.
+	CountingReader struct {
+		n int64
+	}
+
+	// An ErrorAction directs how a Broadcaster handles an error
+	// returned by its io.Reader.
+	ErrorAction int
+
+	// A BackpressurePolicy directs how a Broadcaster treats a
+	// BroadcasterReader that is not keeping up.
+	BackpressurePolicy int
+
+	// A BroadcastStatus describes how a broadcast terminated.
+	BroadcastStatus int
+)
+
+const (
+	// BroadcastPending indicates Broadcast has not returned.
+	BroadcastPending BroadcastStatus = iota
+	// BroadcastCompleted indicates the io.Reader was read to EOF
+	// and all data delivered.
+	BroadcastCompleted
+	// BroadcastAborted indicates the broadcast was aborted.
+	BroadcastAborted
+	// BroadcastFailed indicates the broadcast stopped due to an
+	// error from the io.Reader or a writer.
+	BroadcastFailed
+)
+
+const (
+	// consecutive times a reader's queue must fill or empty before
+	// AutoTuneReadChan grows or shrinks it
+	autoTuneFullCount  = 2
+	autoTuneEmptyCount = 16
+)
+
+const (
+	// ErrorPropagate stops the broadcast and passes the error
+	// to all BroadcasterReaders.
+	ErrorPropagate ErrorAction = iota
+	// ErrorIgnore discards the error and continues reading
+	// from the io.Reader.
+	ErrorIgnore
+	// ErrorAbort aborts the broadcast as though Abort() was called.
+	ErrorAbort
+)
+
+const (
+	// BlockAll blocks the broadcast until a full reader has room.
+	BlockAll BackpressurePolicy = iota
+	// DropSlow discards the new segment for a full reader.
+	DropSlow
+	// DropOldest discards the oldest segment queued for a full
+	// reader in favor of the new one.
+	DropOldest
 )
 
 // NewBroadcaster creates a new Broadcaster from the supplied
@@ -45,140 +437,1713 @@ func NewBroadcaster(r io.Reader) *Broadcaster {
 		r:              r,
 		ReadChanLength: DefaultReadChanLength,
 		ReadBufferSize: DefaultBufferSize,
+		Metrics:        NopMetrics{},
 		abort:          make(chan struct{}),
+		closing:        make(chan struct{}, 1),
 	}
 
 }
 
+// NewLimitedBroadcaster creates a new Broadcaster, as NewBroadcaster
+// does, that broadcasts only the first n bytes of r.  r is never
+// read past n bytes, and the readers receive io.EOF after exactly
+// n bytes, or fewer if r ends first.
+func NewLimitedBroadcaster(r io.Reader, n int64) *Broadcaster {
+	return NewBroadcaster(io.LimitReader(r, n))
+}
+
 // NewReader creates a new BroadcasterReader that can be
 // consumed as though it were the original io.Reader
-// supplied to the Broadcaster.
+// supplied to the Broadcaster.  It is safe to call at any time,
+// including while Broadcast is running, in which case the reader
+// receives the segments read after it joins.
 func (b *Broadcaster) NewReader() *BroadcasterReader {
 
+	if !b.AutoTuneReadChan {
+		br := b.newReader(b.ReadChanLength)
+		b.add(br)
+		return br
+	}
+
+	limit := b.ReadChanLength
+	if limit < 1 {
+		limit = 1
+	}
+
+	br := b.newReader(0)
+	br.limit = int32(limit)
+	br.in = make(chan *broadcastBuffer)
+	b.add(br)
+	go b.queue(br)
+
+	return br
+
+}
+
+// NewReaderFrom creates a new BroadcasterReader, as NewReader does,
+// whose Close also closes c and returns its error, such as to tear
+// down the connection the reader's data is forwarded to.  The reader
+// is removed from the broadcast whether or not c fails to close.
+func (b *Broadcaster) NewReaderFrom(c io.Closer) *BroadcasterReader {
+
+	br := b.NewReader()
+	br.closer = c
+
+	return br
+
+}
+
+// NewReaderWithPrefix creates a new BroadcasterReader, as NewReader
+// does, whose reads yield prefix before the broadcast data, such as
+// a header particular to one of several sinks of the same stream.
+// prefix is copied, and counts toward BytesRead.
+func (b *Broadcaster) NewReaderWithPrefix(prefix []byte) *BroadcasterReader {
+
+	br := b.NewReader()
+	br.buf = append([]byte(nil), prefix...)
+
+	return br
+
+}
+
+// NewReaderWithSnapshot creates a new BroadcasterReader, as
+// NewReader does, whose reads yield the data of snapshot before the
+// broadcast data, such as the current state of a live feed followed
+// by the updates to it.  The reader joins the broadcast when it is
+// created, receiving the segments read from the io.Reader after
+// that point, which queue for it while it reads snapshot, subject
+// to backpressure and SlowReaderTimeout as for any reader.  Once
+// snapshot returns io.EOF, reads continue with the first of those
+// segments, so the reader sees neither a gap nor an overlap between
+// them provided snapshot holds exactly the state up to that point,
+// which is the caller's responsibility.  An error of snapshot other
+// than io.EOF is returned by Read.  snapshot counts toward
+// BytesRead.
+func (b *Broadcaster) NewReaderWithSnapshot(snapshot io.Reader) *BroadcasterReader {
+
+	br := b.NewReader()
+	br.snapshot = snapshot
+
+	return br
+
+}
+
+// NewUnbufferedSafeReader creates a new BroadcasterReader that
+// never applies backpressure to the broadcast.  Rather than being
+// limited to ReadChanLength, the data it has yet to read is queued
+// without bound, so a reader doing heavy work does not slow the
+// source or the other readers.  The cost is that memory grows by
+// however far the reader falls behind.
+func (b *Broadcaster) NewUnbufferedSafeReader() *BroadcasterReader {
+
+	br := b.newReader(b.ReadChanLength)
+	br.in = make(chan *broadcastBuffer)
+	b.add(br)
+	go b.queue(br)
+
+	return br
+
+}
+
+// ID returns the ID of the BroadcasterReader.  IDs are assigned
+// in the order readers are created, starting from zero.
+func (br *BroadcasterReader) ID() int {
+	return br.id
+}
+
+// Error describes how far behind the BroadcasterReader was.
+func (e *ReaderDroppedError) Error() string {
+	return fmt.Sprintf("reader %d timed out after %s with %d segments unread", e.ID, e.Waited, e.Queued)
+}
+
+// Unwrap returns ErrReaderTimedOut.
+func (e *ReaderDroppedError) Unwrap() error {
+	return ErrReaderTimedOut
+}
+
+// Error describes the segments expected and received.
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("reader %d received segment %d, expected %d", e.ID, e.Got, e.Expected)
+}
+
+// Unwrap returns ErrOutOfSequence.
+func (e *SequenceError) Unwrap() error {
+	return ErrOutOfSequence
+}
+
+// RecordRead does nothing.
+func (NopMetrics) RecordRead(n int) {}
+
+// RecordReaderLag does nothing.
+func (NopMetrics) RecordReaderLag(id int, n int) {}
+
+// RecordDrop does nothing.
+func (NopMetrics) RecordDrop(id int) {}
+
+// ChanLength returns the number of segments the BroadcasterReader
+// may have queued before it applies backpressure to the broadcast,
+// which varies under AutoTuneReadChan.  Returns zero for readers
+// created with NewUnbufferedSafeReader, which are unbounded.
+func (br *BroadcasterReader) ChanLength() int {
+
+	if br.in == br.data {
+		return cap(br.data)
+	}
+
+	return int(atomic.LoadInt32(&br.limit))
+
+}
+
+// Creates a BroadcasterReader receiving from the broadcast over
+// a channel of length n.
+func (b *Broadcaster) newReader(n int) *BroadcasterReader {
+
 	br := &BroadcasterReader{
 		b:        b,
-		data:     make(chan []byte, b.ReadChanLength),
+		data:     make(chan *broadcastBuffer, n),
 		err:      make(chan error, 2), // one for EOF, one for ErrClosed
 		shutdown: make(chan struct{}),
 	}
+	br.in = br.data
+
+	return br
+
+}
+
+// add assigns br an ID and adds it to the broadcast.  brs is only
+// modified with mu held, and while a broadcast runs only by its
+// goroutine, which reads brs without locking, so br is queued on
+// joining and joins at the next segment sent.  A reader added after
+// the broadcast has ended is appended to brs, for Reset, and
+// receives its end immediately.
+func (b *Broadcaster) add(br *BroadcasterReader) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br.id = b.nextID
+	b.nextID++
+
+	if b.added != nil {
+		close(b.added)
+		b.added = nil
+	}
+
+	if !b.ended {
+		b.joining = append(b.joining, br)
+		return
+	}
 
+	// kept for Reset
 	b.brs = append(b.brs, br)
 
-	return br
+	close(br.in)
+	if b.endErr != ErrAborted {
+		br.err <- b.endErr
+	}
 
 }
 
-// Broadcast initiates reads from the supplied io.Reader
-// and sends them to the BroadcasterReaders.  The bytes
-// read from the io.Reader are sent over channels so the
-// entire sequence is safely concurrent.  It returns any
-// error returned by from the underlying io.Reader, except
-// io.EOF.  If Abort() was called, returns ErrAborted.
-// All errors are passed to all the BroadcasterReaders.
-// Broadcast will block until all BroadcasterReaders close.
-func (b *Broadcaster) Broadcast() error {
+// remove removes br from brs.
+func (b *Broadcaster) remove(br *BroadcasterReader) {
 
-	var err error
+	b.mu.Lock()
+	b.brs = deleteBroadcasterReader(b.brs, br)
+	b.mu.Unlock()
 
-	defer func() {
-		for _, br := range b.brs {
-			close(br.data)
+	// the delete reorders brs
+	atomic.StoreInt32(&b.resort, 1)
+
+}
+
+// join moves the readers added since the last segment into brs,
+// ordered by priority.
+func (b *Broadcaster) join() {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.joining) > 0 {
+		b.served += len(b.joining)
+		b.brs = append(b.brs, b.joining...)
+		b.joining = nil
+		atomic.StoreInt32(&b.resort, 1)
+	}
+
+	if atomic.LoadInt32(&b.resort) != 0 {
+		atomic.StoreInt32(&b.resort, 0)
+		sort.SliceStable(b.brs, func(i, j int) bool {
+			return atomic.LoadInt32(&b.brs[i].priority) > atomic.LoadInt32(&b.brs[j].priority)
+		})
+	}
+
+}
+
+// Checksum returns the checksum of the source computed by the
+// Broadcaster's Hash, once Read has returned io.EOF.  It is kept
+// apart from the data so that a reader need not tell a trailer from
+// the stream.  Returns nil if Hash is not set, or the reader has
+// not read the whole stream, as when the broadcast failed.
+func (br *BroadcasterReader) Checksum() []byte {
+
+	if br.last != io.EOF {
+		return nil
+	}
+
+	br.b.mu.Lock()
+	defer br.b.mu.Unlock()
+
+	return br.b.sum
+
+}
+
+// Dropped returns the number of bytes of the broadcast discarded
+// for the BroadcasterReader by the Broadcaster's Backpressure, so
+// that it may detect the gaps in the data it read.  It is safe to
+// call concurrently with Read.
+func (br *BroadcasterReader) Dropped() int64 {
+	return atomic.LoadInt64(&br.dropped)
+}
+
+// BytesRead returns the number of bytes returned by Read so far.
+// It is safe to call concurrently with Read.
+func (br *BroadcasterReader) BytesRead() int64 {
+	return atomic.LoadInt64(&br.n)
+}
+
+// TotalBytesBroadcast returns the number of bytes read from the
+// io.Reader and sent to the BroadcasterReaders so far, from which
+// each reader's lag may be found with BytesRead.  It is safe to
+// call concurrently with Broadcast.
+func (b *Broadcaster) TotalBytesBroadcast() int64 {
+	return atomic.LoadInt64(&b.total)
+}
+
+// ActiveReaders returns the number of BroadcasterReaders still in
+// the broadcast, including those waiting to join it and excluding
+// those that have been closed or dropped.  It is safe to call
+// concurrently with Broadcast.
+func (b *Broadcaster) ActiveReaders() int {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var n int
+
+	for _, brs := range [][]*BroadcasterReader{b.brs, b.joining} {
+		for _, br := range brs {
+			select {
+			case <-br.shutdown:
+			default:
+				n++
+			}
 		}
-		if err != ErrAborted {
-			for _, br := range b.brs {
-				br.err <- err
+	}
+
+	return n
+
+}
+
+// CloseAll closes every BroadcasterReader in the broadcast, as
+// calling Close on each does, such as to tear them down when the
+// broadcast is abandoned.  The closed readers are removed from the
+// broadcast, and those of NewReaderToWriter stop copying without
+// failing it, so Broadcast no longer waits on any of them and
+// returns cleanly, although it continues to read the io.Reader until
+// EOF unless aborted.  It is safe to call concurrently with
+// Broadcast.  Returns the first error of an io.Closer of
+// NewReaderFrom, ignoring readers already closed.
+func (b *Broadcaster) CloseAll() error {
+
+	b.mu.Lock()
+	brs := make([]*BroadcasterReader, 0, len(b.brs)+len(b.joining))
+	brs = append(append(brs, b.brs...), b.joining...)
+	b.mu.Unlock()
+
+	var first error
+
+	for _, br := range brs {
+		if err := br.Close(); err != nil && err != ErrClosed && first == nil {
+			first = err
+		}
+	}
+
+	return first
+
+}
+
+// OnProgress sets fn to be called with TotalBytesBroadcast each time
+// roughly every more bytes have been read from the io.Reader, and
+// once more when the broadcast ends.  fn is called from the
+// broadcast goroutine, which it blocks, so a long running fn should
+// start its own goroutine rather than starve the readers.  This
+// must not be called after calling Broadcast().
+func (b *Broadcaster) OnProgress(every int64, fn func(total int64)) {
+	b.every = every
+	b.progress = fn
+}
+
+// SetPriority sets the priority of the BroadcasterReader, which
+// is zero by default.  Each segment is sent to the readers in
+// order of descending priority, so a reader of higher priority
+// receives it before the broadcast waits on any reader of lower
+// priority, keeping it the more current when readers contend.
+// Readers of equal priority are sent to in an unspecified order.
+// A reader with a positive priority is never dropped by
+// SlowReaderTimeout, which instead waits for it indefinitely.
+// The priority takes effect from the next segment sent.
+func (br *BroadcasterReader) SetPriority(p int) {
+	atomic.StoreInt32(&br.priority, int32(p))
+	atomic.StoreInt32(&br.b.resort, 1)
+}
+
+// queue forwards segments from br.in to br.data through a queue
+// bounded by br.limit, or unbounded if it is zero.  A bounded queue
+// is tuned as described by AutoTuneReadChan.
+func (b *Broadcaster) queue(br *BroadcasterReader) {
+
+	var (
+		in     = br.in
+		out    = br.data
+		queue  []*broadcastBuffer
+		closed bool
+
+		limit = int(br.limit)
+		max   = b.MaxReadChanLength
+		full  int
+		empty int
+	)
+
+	if max < limit {
+		max = 8 * limit
+	}
+
+	defer func() {
+		close(out)
+		if closed {
+			// release what the reader will never receive
+			for _, buf := range queue {
+				b.release(buf)
+			}
+			for buf := range out {
+				b.release(buf)
 			}
 		}
 	}()
 
-	for {
-		buf := make([]byte, b.ReadBufferSize)
-		var n int
-		for n < len(buf) && err == nil {
-			var nn int
-			nn, err = b.r.Read(buf[n:])
-			n += nn
+	for in != nil || len(queue) > 0 {
+		var (
+			recv = in
+			send chan<- *broadcastBuffer
+			next *broadcastBuffer
+		)
+		if limit > 0 && len(queue) >= limit {
+			recv = nil
 		}
-		if n > 0 {
-			buf = buf[:n]
-			for _, br := range b.brs {
-				select {
-				case br.data <- buf:
-				case <-br.shutdown:
-					close(br.data)
-					close(br.err)
-					b.brs = deleteBroadcasterReader(b.brs, br)
-				case <-b.abort:
-					return ErrAborted
+		if len(queue) > 0 {
+			send, next = out, queue[0]
+		}
+		select {
+		case buf, open := <-recv:
+			if !open {
+				in = nil
+				continue
+			}
+			queue = append(queue, buf)
+			if limit > 0 && len(queue) == limit {
+				empty = 0
+				if full++; full >= autoTuneFullCount && limit < max {
+					full = 0
+					if limit *= 2; limit > max {
+						limit = max
+					}
+					atomic.StoreInt32(&br.limit, int32(limit))
 				}
 			}
-		}
-		if err != nil {
-			if err == io.EOF {
-				return nil
+		case send <- next:
+			queue[0] = nil
+			queue = queue[1:]
+			if limit > 0 && len(queue) == 0 {
+				full = 0
+				if empty++; empty >= autoTuneEmptyCount && limit > 1 {
+					empty = 0
+					limit /= 2
+					atomic.StoreInt32(&br.limit, int32(limit))
+				}
 			}
-			return err
+		case <-br.shutdown:
+			closed = true
+			return
+		case <-b.abort:
+			return
 		}
 	}
 
 }
 
-// Abort aborts the broadcast.  Causes the Broadcaster and all
-// BroadcasterReaders to stop reading and return ErrAborted.
-func (b *Broadcaster) Abort() {
-	close(b.abort)
-}
+// NewChannelReader creates a new BroadcasterReader that delivers
+// the broadcast over a channel, for consumers that integrate with
+// select loops.  Each slice received is a copy of a segment read
+// from the source and is owned by the receiver.  The channel is
+// closed when the broadcast ends, after which the returned func
+// reports the terminal error: nil on io.EOF, ErrAborted, or the
+// error of AbortWithError, if the broadcast was aborted, or the
+// error that ended it.  The channel
+// must be drained concurrently with Broadcast like any reader, until
+// it is closed or the returned cancel func is called.  Calling cancel
+// removes the reader from the broadcast as Close does, after which
+// the channel is closed and the terminal error is ErrClosed.  The
+// reader is closed once the channel is, so it does not take part in
+// a broadcast after Reset.
+func (b *Broadcaster) NewChannelReader() (c <-chan []byte, errFunc func() error, cancel func()) {
 
-// Read takes a byte slice and copies broadcast bytes into it
-// and returns number of bytes read and any error encountered.
-func (br *BroadcasterReader) Read(b []byte) (int, error) {
+	var (
+		br   = b.NewReader()
+		out  = make(chan []byte)
+		mu   sync.Mutex
+		err  error
+		once sync.Once
+	)
 
-	if br.last == ErrClosed || br.last == ErrAborted {
-		return 0, br.last
+	setErr := func(e error) {
+		mu.Lock()
+		err = e
+		mu.Unlock()
 	}
 
-LOOP:
-	for len(br.buf) < len(b) {
+	go func() {
+		defer close(out)
+		// the channel cannot be reopened for another broadcast
+		defer once.Do(func() { br.Close() })
+		for buf := range br.data {
+			data := append([]byte(nil), buf.data...)
+			if err := br.received(buf); err != nil {
+				setErr(err)
+				return
+			}
+			select {
+			case out <- data:
+			case <-br.shutdown:
+				setErr(ErrClosed)
+				return
+			case <-b.abort:
+				setErr(b.abortErr)
+				return
+			}
+		}
 		select {
-		case <-br.b.abort:
-			br.last = ErrAborted
-			return 0, br.last
-		case data, open := <-br.data:
-			if !open {
-				break LOOP
+		case e := <-br.err:
+			if e != io.EOF {
+				setErr(e)
 			}
-			br.buf = append(br.buf, data...)
+		case <-b.abort:
+			setErr(b.abortErr)
 		}
-	}
+	}()
 
-	if len(br.buf) > len(b) {
-		n := copy(b, br.buf[:len(b)])
-		l := copy(br.buf[0:], br.buf[n:])
-		br.buf = br.buf[:l]
-		return n, nil
-	}
-	if len(br.buf) > 0 {
-		n := copy(b, br.buf)
-		br.buf = br.buf[:0]
-		return n, nil
+	errFunc = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return err
 	}
 
-	select {
-	case br.last = <-br.err:
-	default:
+	cancel = func() {
+		once.Do(func() { br.Close() })
 	}
 
-	return 0, br.last
+	return out, errFunc, cancel
 
 }
 
-// Close removes the BroadcasterReader from the broadcast
-// stream and causes ErrClosed to be returned on subsequent
-// reads. Close will not block until complete.
-func (br *BroadcasterReader) Close() error {
-	close(br.shutdown)
-	br.err <- ErrClosed
-	return nil
+// NewCountingReader creates a CountingReader that counts every
+// byte broadcast.  It is far lighter than a BroadcasterReader
+// copied to ioutil.Discard, as it holds no data and never applies
+// backpressure.  This must be called before Broadcast().
+func (b *Broadcaster) NewCountingReader() *CountingReader {
+
+	cr := &CountingReader{}
+
+	b.counters = append(b.counters, cr)
+
+	return cr
+
+}
+
+// Count returns the number of bytes broadcast so far.  It is safe
+// to call concurrently with Broadcast.
+func (cr *CountingReader) Count() int64 {
+	return atomic.LoadInt64(&cr.n)
+}
+
+// NewReaderToWriter creates a new BroadcasterReader and copies
+// it to w in a goroutine managed by the Broadcaster.  Broadcast
+// waits for the copy to complete and returns the error from w if
+// the broadcast itself succeeded.  If w fails, the reader is closed
+// and the remaining readers are unaffected.  w is not closed.
+func (b *Broadcaster) NewReaderToWriter(w io.Writer) {
+	b.newPump(w)
+}
+
+// newPump creates a new BroadcasterReader copied to w.
+func (b *Broadcaster) newPump(w io.Writer) *BroadcasterReader {
+
+	br := b.NewReader()
+	br.pump = w
+
+	b.startPump(br)
+
+	return br
+
+}
+
+// startPump copies br to its pump in a goroutine.
+func (b *Broadcaster) startPump(br *BroadcasterReader) {
+
+	w := br.pump
+	br.pumpErr = nil
+
+	b.pumps.Add(1)
+
+	go func() {
+		defer b.pumps.Done()
+		// a reader aborted or closed, as by CloseAll, has not failed
+		if _, err := io.Copy(w, br); err != nil && br.last != ErrAborted && br.last != ErrClosed {
+			br.Close()
+			br.pumpErr = err
+			b.mu.Lock()
+			if b.pumpErr == nil {
+				b.pumpErr = err
+			}
+			b.mu.Unlock()
+		}
+	}()
+
+}
+
+// BroadcastTo broadcasts to each io.Writer in ws through a reader
+// created by NewReaderToWriter, and returns once the broadcast and
+// every copy have completed.  It returns the error of the broadcast,
+// or if it succeeded, the first error from an io.Writer.  A failed
+// io.Writer is removed from the broadcast without affecting the
+// others.  Readers created beforehand are broadcast to as well and
+// must be consumed as usual.
+func (b *Broadcaster) BroadcastTo(ws ...io.Writer) error {
+
+	for _, w := range ws {
+		b.NewReaderToWriter(w)
+	}
+
+	return b.Broadcast()
+
+}
+
+// BroadcastToDetailed is BroadcastTo returning the error of the
+// broadcast and of every io.Writer, rather than only the first, for
+// diagnosing several failed sinks.
+func (b *Broadcaster) BroadcastToDetailed(ws ...io.Writer) BroadcastRunResult {
+
+	brs := make([]*BroadcasterReader, len(ws))
+	for i, w := range ws {
+		brs[i] = b.newPump(w)
+	}
+
+	res := BroadcastRunResult{Writers: make([]error, len(ws))}
+	res.Source, _ = b.run()
+
+	// the copies have completed
+	for i, br := range brs {
+		res.Writers[i] = br.pumpErr
+	}
+
+	return res
+
+}
+
+// Err combines the errors of the broadcast and the io.Writers, or
+// returns nil if there were none.
+func (r BroadcastRunResult) Err() error {
+
+	var errs []error
+
+	if r.Source != nil {
+		errs = append(errs, r.Source)
+	}
+	for _, err := range r.Writers {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return joinErrs(errs)
+
+}
+
+// Broadcast initiates reads from the supplied io.Reader
+// and sends them to the BroadcasterReaders.  The bytes
+// read from the io.Reader are sent over channels so the
+// entire sequence is safely concurrent.  It returns any
+// error returned by from the underlying io.Reader, except
+// io.EOF.  If Abort() was called, returns ErrAborted, or the
+// error of AbortWithError.
+// All errors are passed to all the BroadcasterReaders.
+// Broadcast will block until all BroadcasterReaders close,
+// and until every copy started by NewReaderToWriter completes.
+//
+// Every BroadcasterReader must be consumed concurrently with
+// Broadcast, typically from its own goroutine.  Calling Broadcast
+// before the readers are being read from will deadlock once a
+// reader's channel fills, unless SlowReaderTimeout is set.
+// Readers created with NewReaderToWriter are always consumed.
+func (b *Broadcaster) Broadcast() error {
+	_, err := b.BroadcastStats()
+	return err
+}
+
+// BroadcastStats is Broadcast returning Stats describing the
+// broadcast, which are accurate however it ends, including by Abort.
+func (b *Broadcaster) BroadcastStats() (Stats, error) {
+
+	var (
+		start = time.Now()
+		total = atomic.LoadInt64(&b.total)
+	)
+
+	_, err := b.run()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return Stats{
+		BytesRead:      atomic.LoadInt64(&b.total) - total,
+		Elapsed:        time.Since(start),
+		ReadersServed:  b.served,
+		ReadersDropped: b.dropped,
+	}, err
+
+}
+
+// run runs the broadcast and returns the error of the broadcast
+// itself and the error for Broadcast to return.
+func (b *Broadcaster) run() (src, err error) {
+
+	b.mu.Lock()
+	b.running = true
+	b.served, b.dropped = len(b.brs), 0
+	b.mu.Unlock()
+
+	src = b.broadcast()
+	err = src
+
+	b.pumps.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.running = false
+
+	if err == nil {
+		err = b.pumpErr
+	}
+
+	switch err {
+	case nil:
+		b.status = BroadcastCompleted
+	case ErrAborted:
+		b.status = BroadcastAborted
+	default:
+		b.status = BroadcastFailed
+	}
+	b.err = err
+
+	if src == ErrAborted {
+		src = b.abortErr
+	}
+	if err == ErrAborted {
+		err = b.abortErr
+	}
+
+	return src, err
+
+}
+
+// Reset prepares the Broadcaster to broadcast r with another call
+// to Broadcast, once the previous Broadcast has returned, so that a
+// set of readers may receive a series of sources.  Every reader
+// remaining in the broadcast is re-armed to receive r, including
+// those of NewReaderToWriter, whose copies are restarted.  Readers
+// that were closed or dropped are not, nor are those of
+// NewChannelReader, which close with their channel.  Each reader
+// must have finished reading the previous broadcast, having received
+// its terminal error, and must not be read during Reset.  Abort,
+// Status and Hash are reset, while byte counts continue to
+// accumulate.
+// Returns ErrInProgress if a broadcast is in progress.
+func (b *Broadcaster) Reset(r io.Reader) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running {
+		return ErrInProgress
+	}
+
+	b.r = r
+	b.next, b.replace = nil, 0
+	b.abort = make(chan struct{})
+	b.abortOnce = sync.Once{}
+	b.abortErr = nil
+	b.bucket = nil
+	b.pumpErr, b.status, b.err = nil, BroadcastPending, nil
+	b.ended, b.endErr, b.sum = false, nil, nil
+	if b.Hash != nil {
+		b.Hash.Reset()
+	}
+
+	select {
+	case <-b.closing:
+	default:
+	}
+
+	// readers closed after the broadcast ended remain in brs
+	brs := b.brs[:0]
+	for _, br := range b.brs {
+		select {
+		case <-br.shutdown:
+			continue
+		default:
+		}
+		brs = append(brs, br)
+	}
+	b.brs = brs
+
+	for _, br := range b.brs {
+		queued := br.in != br.data
+		atomic.StoreInt64(&br.queued, 0)
+		br.data = make(chan *broadcastBuffer, cap(br.data))
+		br.in = br.data
+		br.err = make(chan error, 2)
+		br.last = nil
+		br.buf = br.buf[:0]
+		if queued {
+			br.in = make(chan *broadcastBuffer)
+			go b.queue(br)
+		}
+		if br.pump != nil {
+			b.startPump(br)
+		}
+	}
+
+	return nil
+
+}
+
+// Status reports how the broadcast terminated, and the error
+// that caused it to fail, if any.  Returns BroadcastPending
+// until Broadcast returns.
+func (b *Broadcaster) Status() (BroadcastStatus, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.status == BroadcastFailed {
+		return b.status, b.err
+	}
+
+	return b.status, nil
+
+}
+
+// String returns the name of the status.
+func (s BroadcastStatus) String() string {
+	switch s {
+	case BroadcastPending:
+		return "pending"
+	case BroadcastCompleted:
+		return "completed"
+	case BroadcastAborted:
+		return "aborted"
+	case BroadcastFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Reads from the io.Reader and sends to the BroadcasterReaders
+// until EOF, error or abort.
+func (b *Broadcaster) broadcast() error {
+
+	var err error
+
+	if b.SustainedBytesPerSec > 0 {
+		burst := b.BurstBytes
+		if burst <= 0 {
+			burst = b.ReadBufferSize
+		}
+		b.bucket = newTokenBucket(b.SustainedBytesPerSec, burst)
+	}
+
+	defer func() {
+		if mr, ok := b.r.(*mergeReader); ok {
+			mr.close()
+		}
+		b.mu.Lock()
+		b.served += len(b.joining)
+		b.brs = append(b.brs, b.joining...)
+		b.joining = nil
+		b.ended = true
+		b.endErr = err
+		if err == io.EOF && b.Hash != nil {
+			b.sum = b.Hash.Sum(nil)
+		}
+		b.mu.Unlock()
+		if b.progress != nil {
+			b.reported = atomic.LoadInt64(&b.total)
+			b.progress(b.reported)
+		}
+		for _, br := range b.brs {
+			close(br.in)
+		}
+		if err != ErrAborted {
+			for _, br := range b.brs {
+				// never block on a reader whose err channel
+				// is already full from Close
+				select {
+				case br.err <- err:
+				default:
+				}
+			}
+		}
+	}()
+
+	if b.MaxInFlightBuffers > 0 {
+		b.inflight = make(chan struct{}, b.MaxInFlightBuffers)
+	}
+
+	if b.Metrics == nil {
+		b.Metrics = NopMetrics{}
+	}
+
+	if b.MinReaders > 0 {
+		if err = b.waitReaders(); err != nil {
+			return err
+		}
+	}
+
+	if wt, ok := b.writerTo(); ok {
+		if _, err = wt.WriteTo(broadcastWriter{b: b}); err == nil {
+			// readers receive io.EOF at the end of the stream
+			err = io.EOF
+			return nil
+		}
+		return err
+	}
+
+	for {
+		var buf *broadcastBuffer
+		if buf, err = b.newBuffer(); err != nil {
+			return err
+		}
+		var n int
+		for n < len(buf.data) && err == nil {
+			var nn int
+			nn, err = b.read(buf.data[n:])
+			n += nn
+			if err == ErrAborted {
+				return err
+			}
+			if err != nil && err != io.EOF && b.ErrorPolicy != nil {
+				switch b.ErrorPolicy(err) {
+				case ErrorIgnore:
+					err = nil
+				case ErrorAbort:
+					b.Abort()
+					err = ErrAborted
+					return err
+				}
+			}
+		}
+		buf.data = buf.data[:n]
+		if ferr := b.fanout(buf); ferr != nil {
+			err = ferr
+			return err
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+
+}
+
+// writerTo returns the io.WriterTo of the io.Reader if Broadcast
+// should be driven by it, as described by UseWriterTo.
+func (b *Broadcaster) writerTo() (io.WriterTo, bool) {
+
+	wt, ok := b.r.(io.WriterTo)
+	if !ok || b.SustainedBytesPerSec > 0 {
+		return nil, false
+	}
+	if b.UseWriterTo {
+		return wt, true
+	}
+
+	// a pending ReplaceSource is honored by the pull loop
+	if b.ErrorPolicy != nil || atomic.LoadInt32(&b.replace) != 0 {
+		return nil, false
+	}
+
+	switch b.r.(type) {
+	case *bytes.Reader, *strings.Reader, *bytes.Buffer:
+		return wt, true
+	}
+
+	return nil, false
+
+}
+
+// Write sends p to the BroadcasterReaders in segments of at most
+// ReadBufferSize, copying it as the io.WriterTo may reuse p.
+func (w broadcastWriter) Write(p []byte) (int, error) {
+
+	var n int
+
+	for n < len(p) {
+		buf, err := w.b.newBuffer()
+		if err != nil {
+			return n, err
+		}
+		l := copy(buf.data, p[n:])
+		buf.data = buf.data[:l]
+		if err := w.b.fanout(buf); err != nil {
+			return n, err
+		}
+		n += l
+	}
+
+	return n, nil
+
+}
+
+// waitReaders waits until there are at least MinReaders readers.
+// Returns ErrAborted if the broadcast is aborted while waiting.
+func (b *Broadcaster) waitReaders() error {
+
+	for {
+		b.mu.Lock()
+		if len(b.brs)+len(b.joining) >= b.MinReaders {
+			b.mu.Unlock()
+			return nil
+		}
+		if b.added == nil {
+			b.added = make(chan struct{})
+		}
+		added := b.added
+		b.mu.Unlock()
+
+		select {
+		case <-added:
+		case <-b.abort:
+			return ErrAborted
+		}
+	}
+
+}
+
+// newBuffer returns a buffer of ReadBufferSize, first waiting for
+// Resume if paused and for a slot if MaxInFlightBuffers is set.
+func (b *Broadcaster) newBuffer() (*broadcastBuffer, error) {
+
+	if atomic.LoadInt32(&b.paused) != 0 {
+		if err := b.waitResume(); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.inflight != nil {
+		if err := b.acquire(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf *broadcastBuffer
+	if b.PerReaderCopy {
+		// readers never receive the buffer itself
+		if b.spare == nil {
+			b.spare = make([]byte, b.ReadBufferSize)
+		}
+		buf = &broadcastBuffer{data: b.spare}
+	} else if buf, _ = b.bufs.Get().(*broadcastBuffer); buf != nil {
+		// released by every reader, so no longer referenced
+		buf.data = buf.data[:cap(buf.data)]
+		buf.done = nil
+	} else {
+		buf = &broadcastBuffer{data: make([]byte, b.ReadBufferSize)}
+	}
+	if b.LockStep {
+		buf.done = make(chan struct{})
+	}
+
+	return buf, nil
+
+}
+
+// fanout sends buf to every BroadcasterReader, if it holds any
+// data, and releases the Broadcaster's reference to it.  With
+// LockStep, it then waits for every reader to receive buf.
+func (b *Broadcaster) fanout(buf *broadcastBuffer) error {
+
+	buf.refs = 1
+
+	b.join()
+
+	total := atomic.AddInt64(&b.total, int64(len(buf.data)))
+
+	if b.progress != nil && total-b.reported >= b.every && len(buf.data) > 0 {
+		b.reported = total
+		b.progress(total)
+	}
+
+	if b.Hash != nil {
+		b.Hash.Write(buf.data)
+	}
+
+	for _, cr := range b.counters {
+		atomic.AddInt64(&cr.n, int64(len(buf.data)))
+	}
+
+	if len(buf.data) > 0 && b.VerifyMode {
+		b.seq++
+		buf.seq = b.seq
+	}
+
+	if len(buf.data) > 0 {
+		b.Metrics.RecordRead(len(buf.data))
+		buf.refs += int32(len(b.brs))
+		for _, br := range b.brs {
+			c := buf
+			if b.PerReaderCopy {
+				c = &broadcastBuffer{
+					data:   append([]byte(nil), buf.data...),
+					seq:    buf.seq,
+					parent: buf,
+				}
+			}
+			if err := b.send(br, c); err != nil {
+				return err
+			}
+			b.Metrics.RecordReaderLag(br.id, br.lag())
+		}
+	}
+
+	b.release(buf)
+
+	var timeout <-chan time.Time
+
+	if buf.done != nil && b.SlowReaderTimeout > 0 {
+		t := time.NewTimer(b.SlowReaderTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for buf.done != nil {
+		select {
+		case <-buf.done:
+			return nil
+		case <-b.closing:
+			// closed readers will never receive buf
+			b.removeClosedReaders()
+		case <-timeout:
+			timeout = nil
+			b.dropLagging()
+		case <-b.abort:
+			return ErrAborted
+		}
+	}
+
+	return nil
+
+}
+
+// dropLagging drops the readers that have yet to receive the
+// segment sent under LockStep, which is discarded for them so that
+// the broadcast may continue.
+func (b *Broadcaster) dropLagging() {
+
+	for _, br := range b.brs {
+		if br.in != br.data || len(br.data) == 0 || atomic.LoadInt32(&br.priority) > 0 {
+			continue
+		}
+		b.drop(br)
+		for buf := range br.in {
+			b.release(buf)
+		}
+	}
+
+}
+
+// drop removes br from the broadcast for exceeding
+// SlowReaderTimeout.
+func (b *Broadcaster) drop(br *BroadcasterReader) {
+
+	select {
+	case br.err <- &ReaderDroppedError{ID: br.id, Queued: len(br.data), Waited: b.SlowReaderTimeout}:
+	default:
+	}
+	close(br.in)
+	b.remove(br)
+	b.countDropped()
+	b.Metrics.RecordDrop(br.id)
+
+}
+
+// countDropped counts a reader dropped, for Stats.
+func (b *Broadcaster) countDropped() {
+	b.mu.Lock()
+	b.dropped++
+	b.mu.Unlock()
+}
+
+// exceed removes br from the broadcast for exceeding
+// MaxReaderBacklog.
+func (b *Broadcaster) exceed(br *BroadcasterReader) {
+
+	select {
+	case br.err <- ErrBacklogExceeded:
+	default:
+	}
+	close(br.in)
+	b.remove(br)
+	b.countDropped()
+	b.Metrics.RecordDrop(br.id)
+	// the reader discards what is queued once it sees this
+	atomic.StoreInt32(&br.exceeded, 1)
+
+}
+
+// ReplaceSource replaces the io.Reader being broadcast with r.
+// The broadcast continues from r at its next read, so readers
+// receive the data of the previous io.Reader followed by that of
+// r with nothing to mark the switch.  This allows failing over to
+// a backup source, such as from an ErrorPolicy that returns
+// ErrorIgnore after replacing a failed source.  Continuity of the
+// stream, such as r resuming where the previous io.Reader stopped,
+// is the caller's responsibility.  The previous io.Reader is not
+// closed.  ReplaceSource has no effect during a broadcast driven by
+// the io.Reader's WriteTo, as described by UseWriterTo.
+func (b *Broadcaster) ReplaceSource(r io.Reader) {
+
+	b.mu.Lock()
+	b.next = r
+	atomic.StoreInt32(&b.replace, 1)
+	b.mu.Unlock()
+
+}
+
+// Pause stops reading from the io.Reader until Resume is called,
+// without ending the broadcast.  Segments already read continue to
+// be delivered, so the BroadcasterReaders drain their queues and
+// then block until Resume.  The segment being read when Pause is
+// called is completed first.  With UseWriterTo, the writes of the
+// io.Reader block instead.  Abort interrupts a paused broadcast.
+// Calling Pause while paused has no further effect.
+func (b *Broadcaster) Pause() {
+
+	b.mu.Lock()
+	if b.gate == nil {
+		b.gate = make(chan struct{})
+		atomic.StoreInt32(&b.paused, 1)
+	}
+	b.mu.Unlock()
+
+}
+
+// Resume continues reading from the io.Reader after Pause.
+// Calling Resume when not paused has no effect.
+func (b *Broadcaster) Resume() {
+
+	b.mu.Lock()
+	if b.gate != nil {
+		close(b.gate)
+		b.gate = nil
+		atomic.StoreInt32(&b.paused, 0)
+	}
+	b.mu.Unlock()
+
+}
+
+// waitResume waits for Resume while paused.  Readers closed while
+// it waits are removed from the broadcast.  Returns ErrAborted if
+// the broadcast is aborted while waiting.
+func (b *Broadcaster) waitResume() error {
+
+	b.mu.Lock()
+	gate := b.gate
+	b.mu.Unlock()
+
+	if gate == nil {
+		return nil
+	}
+
+	for {
+		select {
+		case <-gate:
+			return nil
+		case <-b.closing:
+			b.removeClosedReaders()
+		case <-b.abort:
+			return ErrAborted
+		}
+	}
+
+}
+
+// read reads from the io.Reader into p, waiting as needed to
+// stay within SustainedBytesPerSec.  Returns ErrAborted if the
+// broadcast is aborted while waiting.
+func (b *Broadcaster) read(p []byte) (int, error) {
+
+	if atomic.LoadInt32(&b.replace) != 0 {
+		if mr, ok := b.r.(*mergeReader); ok {
+			mr.close()
+		}
+		b.mu.Lock()
+		b.r, b.next = b.next, nil
+		atomic.StoreInt32(&b.replace, 0)
+		b.mu.Unlock()
+	}
+
+	if b.bucket != nil {
+		if err := b.bucket.wait(b.abort); err != nil {
+			return 0, err
+		}
+		if burst := int(b.bucket.burst); len(p) > burst {
+			p = p[:burst]
+		}
+		n, err := b.r.Read(p)
+		b.bucket.take(n)
+		return n, err
+	}
+
+	return b.r.Read(p)
+
+}
+
+// acquire waits for a slot among the MaxInFlightBuffers.  Readers
+// closed while it waits are removed from the broadcast, as the
+// buffers queued for them may be the ones being waited on.
+// Returns ErrAborted if the broadcast is aborted while waiting.
+func (b *Broadcaster) acquire() error {
+
+	for {
+		select {
+		case b.inflight <- struct{}{}:
+			return nil
+		case <-b.closing:
+			b.removeClosedReaders()
+		case <-b.abort:
+			return ErrAborted
+		}
+	}
+
+}
+
+// removeClosedReaders removes every closed reader from the broadcast.
+func (b *Broadcaster) removeClosedReaders() {
+
+	for _, br := range b.brs {
+		select {
+		case <-br.shutdown:
+			b.removeClosed(br)
+		default:
+		}
+	}
+
+}
+
+// removeClosed removes a closed br from the broadcast and releases
+// the buffers queued for it.
+func (b *Broadcaster) removeClosed(br *BroadcasterReader) {
+
+	// br.err is left open for Close to send ErrClosed
+	close(br.in)
+	b.remove(br)
+
+	if br.in == br.data {
+		// the reader will never receive what is queued
+		for buf := range br.in {
+			b.release(buf)
+		}
+	}
+
+}
+
+// release drops a reference to buf, freeing its slot among the
+// MaxInFlightBuffers once every reader has received it.
+func (b *Broadcaster) release(buf *broadcastBuffer) {
+	if buf.parent != nil {
+		buf = buf.parent
+	}
+	if atomic.AddInt32(&buf.refs, -1) == 0 {
+		if b.inflight != nil {
+			<-b.inflight
+		}
+		if buf.done != nil {
+			close(buf.done)
+		}
+		if !b.PerReaderCopy {
+			b.bufs.Put(buf)
+		}
+	}
+}
+
+// send delivers buf to br, removing br from the broadcast if it
+// has closed or has not accepted buf within SlowReaderTimeout.
+// Returns ErrAborted if the broadcast is aborted while waiting.
+func (b *Broadcaster) send(br *BroadcasterReader, buf *broadcastBuffer) error {
+
+	var timeout <-chan time.Time
+
+	// an abort or close takes priority over a reader ready to receive
+	select {
+	case <-b.abort:
+		return ErrAborted
+	case <-br.shutdown:
+		b.removeClosed(br)
+		b.release(buf)
+		return nil
+	default:
+	}
+
+	if b.MaxReaderBacklog > 0 {
+		n := int64(len(buf.data))
+		if atomic.AddInt64(&br.backlog, n) > int64(b.MaxReaderBacklog) {
+			b.exceed(br)
+			b.release(buf)
+			return nil
+		}
+	}
+
+	if b.Backpressure != BlockAll && br.in == br.data {
+		select {
+		case br.in <- buf:
+			return nil
+		default:
+		}
+		if b.Backpressure == DropOldest {
+			// only the broadcast sends on br.in, so once the
+			// oldest is evicted, or read, there is room
+			select {
+			case old := <-br.data:
+				b.discard(br, old)
+			default:
+			}
+			select {
+			case br.in <- buf:
+				return nil
+			default:
+			}
+		}
+		b.discard(br, buf)
+		return nil
+	}
+
+	if b.SlowReaderTimeout > 0 && atomic.LoadInt32(&br.priority) <= 0 {
+		select {
+		case br.in <- buf:
+			br.sent()
+			return nil
+		default:
+		}
+		t := time.NewTimer(b.SlowReaderTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case br.in <- buf:
+		br.sent()
+	case <-br.shutdown:
+		b.removeClosed(br)
+		b.release(buf)
+	case <-timeout:
+		b.drop(br)
+		b.release(buf)
+	case <-b.abort:
+		return ErrAborted
+	}
+
+	return nil
+
+}
+
+// discard releases buf, sent to br, without br receiving it.
+func (b *Broadcaster) discard(br *BroadcasterReader, buf *broadcastBuffer) {
+
+	n := int64(len(buf.data))
+
+	atomic.AddInt64(&br.dropped, n)
+	if b.MaxReaderBacklog > 0 {
+		atomic.AddInt64(&br.backlog, -n)
+	}
+	b.release(buf)
+
+}
+
+// Abort aborts the broadcast.  Causes the Broadcaster and all
+// BroadcasterReaders to stop reading and return ErrAborted.
+// Calling Abort more than once has no further effect.  It is
+// equivalent to AbortWithError(ErrAborted).
+func (b *Broadcaster) Abort() {
+	b.AbortWithError(ErrAborted)
+}
+
+// AbortWithError aborts the broadcast as Abort does, but Broadcast
+// and the reads of all BroadcasterReaders return err in place of
+// ErrAborted, carrying the reason for the abort, such as the failure
+// of a downstream consumer.  Status still reports BroadcastAborted.
+// Only the first of any concurrent or repeated calls to Abort or
+// AbortWithError takes effect.  A nil err is treated as ErrAborted.
+func (b *Broadcaster) AbortWithError(err error) {
+	if err == nil {
+		err = ErrAborted
+	}
+	b.abortOnce.Do(func() {
+		b.abortErr = err
+		close(b.abort)
+	})
+}
+
+// Read takes a byte slice and copies broadcast bytes into it
+// and returns number of bytes read and any error encountered.
+// A Read of an empty slice neither blocks nor consumes anything,
+// returning 0 and nil, or the error of a reader that was aborted,
+// closed, or has already returned its terminal error.
+func (br *BroadcasterReader) Read(b []byte) (int, error) {
+
+	if t, _ := br.deadline.Load().(time.Time); !t.IsZero() {
+		ctx, cancel := context.WithDeadline(context.Background(), t)
+		defer cancel()
+		n, err := br.ReadContext(ctx, b)
+		if err == context.DeadlineExceeded {
+			err = os.ErrDeadlineExceeded
+		}
+		return n, err
+	}
+
+	return br.ReadContext(context.Background(), b)
+
+}
+
+// SetReadDeadline sets the deadline for Reads, as net.Conn does.  A
+// Read that has received no data by t returns os.ErrDeadlineExceeded,
+// leaving the BroadcasterReader in the broadcast to be read again,
+// with no data lost.  The deadline applies to Reads that begin after
+// it is set.  A zero t clears the deadline.  It is safe to call
+// concurrently with Read.
+func (br *BroadcasterReader) SetReadDeadline(t time.Time) error {
+	br.deadline.Store(t)
+	return nil
+}
+
+// ReadContext is Read bounded by ctx.  If ctx is done before the
+// next segment arrives, it returns any bytes already received, or
+// ctx.Err() if there are none, leaving the BroadcasterReader in the
+// broadcast to be read again.  Data already received, the end of
+// the broadcast and Abort take precedence over ctx.
+func (br *BroadcasterReader) ReadContext(ctx context.Context, b []byte) (int, error) {
+
+	if atomic.LoadInt32(&br.exceeded) != 0 && br.last != ErrBacklogExceeded {
+		br.buf = nil
+		for buf := range br.data {
+			br.b.release(buf)
+		}
+		br.last = ErrBacklogExceeded
+	}
+
+	if br.verifyErr != nil {
+		return 0, br.verifyErr
+	}
+
+	if br.last == ErrAborted {
+		return 0, br.b.abortErr
+	}
+	if br.last == ErrClosed || br.last == ErrBacklogExceeded {
+		return 0, br.last
+	}
+
+	if len(b) == 0 {
+		// the terminal error is not taken while data may remain
+		select {
+		case <-br.b.abort:
+			br.last = ErrAborted
+			return 0, br.b.abortErr
+		default:
+		}
+		return 0, br.last
+	}
+
+	if br.snapshot != nil {
+		// the snapshot is returned alone until it is exhausted
+		if n, err := br.readSnapshot(b); br.snapshot != nil || n > 0 {
+			return n, err
+		}
+	}
+
+LOOP:
+	for len(br.buf) < len(b) {
+		select {
+		case <-br.b.abort:
+			br.last = ErrAborted
+			return 0, br.b.abortErr
+		case buf, open := <-br.data:
+			if !open {
+				break LOOP
+			}
+			br.buf = append(br.buf, buf.data...)
+			if err := br.received(buf); err != nil {
+				return 0, err
+			}
+		case <-ctx.Done():
+			select {
+			case <-br.b.abort:
+				br.last = ErrAborted
+				return 0, br.b.abortErr
+			case buf, open := <-br.data:
+				if !open {
+					break LOOP
+				}
+				br.buf = append(br.buf, buf.data...)
+				if err := br.received(buf); err != nil {
+					return 0, err
+				}
+				continue
+			default:
+			}
+			if len(br.buf) > 0 {
+				break LOOP
+			}
+			return 0, ctx.Err()
+		}
+	}
+
+	if len(br.buf) > len(b) {
+		n := copy(b, br.buf[:len(b)])
+		l := copy(br.buf[0:], br.buf[n:])
+		br.buf = br.buf[:l]
+		atomic.AddInt64(&br.n, int64(n))
+		return n, nil
+	}
+	if len(br.buf) > 0 {
+		n := copy(b, br.buf)
+		br.buf = br.buf[:0]
+		atomic.AddInt64(&br.n, int64(n))
+		return n, nil
+	}
+
+	select {
+	case br.last = <-br.err:
+	default:
+	}
+
+	return 0, br.last
+
+}
+
+// readSnapshot reads the snapshot of NewReaderWithSnapshot, which is
+// discarded once it returns io.EOF.
+func (br *BroadcasterReader) readSnapshot(b []byte) (int, error) {
+
+	select {
+	case <-br.b.abort:
+		br.last = ErrAborted
+		return 0, br.b.abortErr
+	default:
+	}
+
+	n, err := br.snapshot.Read(b)
+	atomic.AddInt64(&br.n, int64(n))
+	if err == io.EOF {
+		br.snapshot, err = nil, nil
+	}
+
+	return n, err
+
+}
+
+// sent counts a segment sent to a reader whose segments are queued,
+// whose queue is not visible in data.
+func (br *BroadcasterReader) sent() {
+	if br.in != br.data {
+		atomic.AddInt64(&br.queued, 1)
+	}
+}
+
+// lag returns the number of segments sent to br that it has yet to
+// read.
+func (br *BroadcasterReader) lag() int {
+	if br.in != br.data {
+		return int(atomic.LoadInt64(&br.queued))
+	}
+	return len(br.data)
+}
+
+// received releases buf once its data is copied out by Read.
+// Under VerifyMode, it returns a *SequenceError if buf is out of
+// sequence, discarding the data received and closing the reader.
+func (br *BroadcasterReader) received(buf *broadcastBuffer) error {
+
+	if br.b.MaxReaderBacklog > 0 {
+		atomic.AddInt64(&br.backlog, -int64(len(buf.data)))
+	}
+	if br.in != br.data {
+		atomic.AddInt64(&br.queued, -1)
+	}
+
+	seq := buf.seq
+	br.b.release(buf)
+
+	if !br.b.VerifyMode {
+		return nil
+	}
+
+	// a reader joining the broadcast may start at any segment, and
+	// the gaps of Backpressure are expected
+	gaps := br.b.Backpressure != BlockAll && seq > br.next
+	if br.next != 0 && seq != br.next && !gaps {
+		br.verifyErr = &SequenceError{ID: br.id, Expected: br.next, Got: seq}
+		br.buf = nil
+		br.Close()
+		return br.verifyErr
+	}
+	br.next = seq + 1
+
+	return nil
+
+}
+
+// Close removes the BroadcasterReader from the broadcast
+// stream and causes ErrClosed to be returned on subsequent
+// reads. Close will not block until complete.  It is safe to
+// call at any point of the broadcast, including as it ends.
+// Returns the error of the io.Closer of NewReaderFrom, if any.
+// Subsequent calls return ErrClosed.
+func (br *BroadcasterReader) Close() error {
+	err := ErrClosed
+	br.closed.Do(func() {
+		close(br.shutdown)
+		select {
+		case br.b.closing <- struct{}{}:
+		default:
+		}
+		br.err <- ErrClosed
+		err = nil
+		if br.closer != nil {
+			err = br.closer.Close()
+		}
+	})
+	return err
 }
 
 // deletes a BroadcasterReader from a BroadcasterReader slice
@@ -1,12 +1,18 @@
 package extio
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"io"
 	"io/ioutil"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -18,13 +24,36 @@ type (
 	errorReader struct {
 		err error
 	}
+	flakyReader struct {
+		*bytes.Reader
+		err      error
+		failures int
+	}
+	readerFunc func(b []byte) (int, error)
+	writerFunc func(b []byte) (int, error)
 )
 
+func (r *flakyReader) Read(b []byte) (int, error) {
+	if r.failures > 0 {
+		r.failures--
+		return 0, r.err
+	}
+	return r.Reader.Read(b)
+}
+
 func (r *sleepyReader) Read(b []byte) (int, error) {
 	time.Sleep(100 * time.Millisecond)
 	return r.Reader.Read(b)
 }
 
+func (f readerFunc) Read(b []byte) (int, error) {
+	return f(b)
+}
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
 func (r *errorReader) Read(_ []byte) (int, error) {
 	return 0, r.err
 }
@@ -120,6 +149,84 @@ func TestBroadcasterAbort(t *testing.T) {
 
 }
 
+func TestBroadcasterAbortWithError(t *testing.T) {
+
+	reason := errors.New("downstream failed")
+
+	b := NewBroadcaster(&sleepyReader{bytes.NewReader(data)})
+	br := b.NewReader()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.AbortWithError(reason)
+			b.Abort()
+		}()
+	}
+	wg.Wait()
+
+	if _, err := io.Copy(ioutil.Discard, br); err != reason {
+		t.Errorf("Expected %q, got %q", reason, err)
+	}
+	if _, err := br.Read(nil); err != reason {
+		t.Errorf("Expected %q, got %q", reason, err)
+	}
+	if err := <-done; err != reason {
+		t.Errorf("Expected %q, got %q", reason, err)
+	}
+	if status, _ := b.Status(); status != BroadcastAborted {
+		t.Errorf("Expected %s, got %s", BroadcastAborted, status)
+	}
+
+}
+
+func TestBroadcasterReadEmpty(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	br := b.NewReader()
+
+	// before any data
+	if n, err := br.Read(nil); n != 0 || err != nil {
+		t.Errorf("Expected 0 and nil, got %d and %v", n, err)
+	}
+
+	if err := b.Broadcast(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the broadcast has ended but data remains
+	for _, p := range [][]byte{nil, {}} {
+		if n, err := br.Read(p); n != 0 || err != nil {
+			t.Errorf("Expected 0 and nil, got %d and %v", n, err)
+		}
+	}
+	if got, err := ioutil.ReadAll(br); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+
+	// at EOF
+	if n, err := br.Read(nil); n != 0 || err != io.EOF {
+		t.Errorf("Expected 0 and %q, got %d and %v", io.EOF, n, err)
+	}
+
+	// aborted
+	b = NewBroadcaster(bytes.NewReader(data))
+	br = b.NewReader()
+	b.Abort()
+	if n, err := br.Read(nil); n != 0 || err != ErrAborted {
+		t.Errorf("Expected 0 and %q, got %d and %v", ErrAborted, n, err)
+	}
+
+}
+
 func TestBroadcasterClose(t *testing.T) {
 
 	var data [32]byte
@@ -149,6 +256,200 @@ func TestBroadcasterClose(t *testing.T) {
 
 }
 
+func TestBroadcasterNewReaderFrom(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	br := b.NewReaderFrom(&testErrorWriteCloser{})
+	other := b.NewReader()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	if err := br.Close(); err != closeErr {
+		t.Errorf("Expected %q, got %q", closeErr, err)
+	}
+	if err := br.Close(); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+	// the failed reader no longer holds up the broadcast
+	if got, err := ioutil.ReadAll(other); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+}
+
+func TestBroadcasterNewReaderWithPrefix(t *testing.T) {
+
+	prefix := []byte("header\n")
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	prefixed := b.NewReaderWithPrefix(prefix)
+	plain := b.NewReader()
+
+	done := make(chan []byte, 1)
+	go func() {
+		got, _ := ioutil.ReadAll(plain)
+		done <- got
+	}()
+	go b.Broadcast()
+
+	if got, err := ioutil.ReadAll(prefixed); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, append(prefix, data...)) {
+		t.Errorf("Expected the prefix and %d bytes of data, got %.20q and %d bytes", len(data), got, len(got))
+	}
+	if got := <-done; !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+
+}
+
+func TestBroadcasterNewReaderWithSnapshot(t *testing.T) {
+
+	pr, pw := io.Pipe()
+
+	b := NewBroadcaster(pr)
+	b.ReadBufferSize = 100
+	live := b.NewReader()
+
+	done := make(chan []byte, 1)
+	go func() {
+		got, _ := ioutil.ReadAll(live)
+		done <- got
+	}()
+	go b.Broadcast()
+
+	// once the first half is broadcast, the state so far is the
+	// snapshot of a reader attaching to the feed, at a segment
+	// boundary as the broadcast reads whole segments
+	half := len(data) / 2 / b.ReadBufferSize * b.ReadBufferSize
+	if _, err := pw.Write(data[:half]); err != nil {
+		t.Fatal(err)
+	}
+	for b.TotalBytesBroadcast() < int64(half) {
+		time.Sleep(time.Millisecond)
+	}
+	br := b.NewReaderWithSnapshot(bytes.NewReader(data[:half]))
+
+	go func() {
+		pw.Write(data[half:])
+		pw.Close()
+	}()
+
+	got, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected the snapshot and live data of %d bytes, got %d bytes", len(data), len(got))
+	}
+	if n := br.BytesRead(); n != int64(len(data)) {
+		t.Errorf("Expected %d bytes read, got %d", len(data), n)
+	}
+	if got := <-done; !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+
+	// an error of the snapshot is returned by Read
+	testError := errors.New("test")
+	b = NewBroadcaster(bytes.NewReader(data))
+	br = b.NewReaderWithSnapshot(&errorReader{err: testError})
+	go b.Broadcast()
+	if _, err := br.Read(make([]byte, 10)); err != testError {
+		t.Errorf("Expected %q, got %v", testError, err)
+	}
+	br.Close()
+
+}
+
+func TestBroadcasterActiveReaders(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	b.SlowReaderTimeout = 10 * time.Millisecond
+	brs := []*BroadcasterReader{b.NewReader(), b.NewReader(), b.NewReader()}
+
+	if n := b.ActiveReaders(); n != 3 {
+		t.Errorf("Expected 3 readers, got %d", n)
+	}
+
+	brs[0].Close()
+	if n := b.ActiveReaders(); n != 2 {
+		t.Errorf("Expected 2 readers, got %d", n)
+	}
+
+	// brs[1] is dropped for never reading, while brs[2] is exempt
+	brs[2].SetPriority(1)
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+	if _, err := ioutil.ReadAll(brs[2]); err != nil {
+		t.Error(err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if n := b.ActiveReaders(); n != 1 {
+		t.Errorf("Expected 1 reader, got %d", n)
+	}
+
+}
+
+func TestBroadcasterCloseAll(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+
+	// none of the readers read, so the broadcast blocks on them
+	brs := []*BroadcasterReader{
+		b.NewReader(),
+		b.NewReaderFrom(&testErrorWriteCloser{}),
+		b.NewReader(),
+	}
+	b.NewReaderToWriter(writerFunc(func(p []byte) (int, error) {
+		time.Sleep(time.Second)
+		return len(p), nil
+	}))
+	brs[2].Close()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := b.CloseAll(); err != closeErr {
+		t.Errorf("Expected %q, got %q", closeErr, err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast did not return")
+	}
+
+	for i, br := range brs {
+		if _, err := br.Read(make([]byte, 1)); err != ErrClosed {
+			t.Errorf("%d: Expected %q, got %q", i, ErrClosed, err)
+		}
+	}
+	if n := b.ActiveReaders(); n != 0 {
+		t.Errorf("Expected no readers, got %d", n)
+	}
+
+}
+
 func TestBroadcasterCloseDuringRead(t *testing.T) {
 
 	b := NewBroadcaster(&sleepyReader{bytes.NewReader(data)})
@@ -174,83 +475,2022 @@ func TestBroadcasterCloseDuringRead(t *testing.T) {
 
 	time.Sleep(300 * time.Millisecond) // wait for our sleepy reader
 
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if len(b.brs) != 0 {
 		t.Errorf("Expected %d readers, got %d", 0, len(b.brs))
 	}
 
 }
 
-func TestBroadcasterErrors(t *testing.T) {
+func TestBroadcasterLateReader(t *testing.T) {
 
-	testError := errors.New("test")
+	pr, pw := io.Pipe()
 
-	b := NewBroadcaster(&errorReader{err: testError})
+	b := NewBroadcaster(pr)
+	b.ReadBufferSize = 3
 
-	br := b.NewReader()
+	first := b.NewReader()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	buf := make([]byte, 3)
+
+	go pw.Write([]byte("one"))
+	if _, err := io.ReadFull(first, buf); err != nil || string(buf) != "one" {
+		t.Errorf("Expected %q, got %q (%v)", "one", buf, err)
+	}
 
+	// a reader added mid-stream receives subsequent segments
+	late := b.NewReader()
 	go func() {
-		if err := b.Broadcast(); err != testError {
-			t.Errorf("Expected %q, got %q", testError, err)
-		}
+		pw.Write([]byte("two"))
+		pw.Close()
 	}()
 
-	var buf [2]byte
-	if _, err := br.Read(buf[:]); err != testError {
-		t.Errorf("Expected %q, got %q", testError, err)
+	for _, br := range []*BroadcasterReader{first, late} {
+		out, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(out) != "two" {
+			t.Errorf("Expected %q, got %q", "two", out)
+		}
 	}
 
-	// close should not emit read error
-	if err := br.Close(); err != nil {
+	if err := <-done; err != nil {
 		t.Error(err)
 	}
 
+	// a reader added after the broadcast ends reads EOF
+	if _, err := b.NewReader().Read(buf); err != io.EOF {
+		t.Errorf("Expected %q, got %q", io.EOF, err)
+	}
+
 }
 
-func TestDeleteBroadcasterReader(t *testing.T) {
+func TestBroadcasterCloseStress(t *testing.T) {
 
-	b := NewBroadcaster(bytes.NewReader([]byte{}))
+	for i := 0; i < 200; i++ {
+
+		b := NewBroadcaster(bytes.NewReader(data))
+		b.ReadBufferSize = 64
+		b.ReadChanLength = 1
+
+		var wg sync.WaitGroup
+
+		for j := 0; j < 4; j++ {
+			br := b.NewReader()
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				buf := make([]byte, 64)
+				for k := 0; k < i%20+j; k++ {
+					if _, err := br.Read(buf); err != nil {
+						break
+					}
+				}
+				br.Close()
+				br.Read(buf)
+			}(j)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- b.Broadcast() }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Broadcast blocked on closing readers")
+		}
+
+		wg.Wait()
 
-	orig := []*BroadcasterReader{
-		b.NewReader(),
-		b.NewReader(),
-		b.NewReader(),
 	}
 
-	testset := append([]*BroadcasterReader(nil), orig...)
+}
 
-	testset = deleteBroadcasterReader(testset, orig[1])
-	for _, br := range testset {
-		if br == orig[1] {
-			t.Error("Failed to delete middle element")
+func TestBroadcasterCloseAtEOF(t *testing.T) {
+
+	for i := 0; i < 200; i++ {
+
+		b := NewBroadcaster(bytes.NewReader(data[:256]))
+		b.ReadBufferSize = 64
+
+		var wg sync.WaitGroup
+
+		for j := 0; j < 4; j++ {
+			br := b.NewReader()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				buf := make([]byte, 64)
+				for k := 0; k < 4; k++ {
+					br.Read(buf)
+				}
+				// races the end of the broadcast
+				if err := br.Close(); err != nil {
+					t.Error(err)
+				}
+				if err := br.Close(); err != ErrClosed {
+					t.Errorf("Expected %q, got %q", ErrClosed, err)
+				}
+			}()
 		}
+
+		if err := b.Broadcast(); err != nil {
+			t.Error(err)
+		}
+
+		wg.Wait()
+
 	}
 
-	testset = deleteBroadcasterReader(testset, orig[1])
-	for _, br := range testset {
-		if br == orig[1] {
-			t.Error("Failed to delete last element")
+}
+
+func TestBroadcasterUnbufferedSafeReader(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 16
+	b.ReadChanLength = 1
+
+	var (
+		heavy    = b.NewUnbufferedSafeReader()
+		heavyOut []byte
+		outputs  = []*bytes.Buffer{
+			&bytes.Buffer{},
+			&bytes.Buffer{},
 		}
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+
+	for _, out := range outputs {
+		b.NewReaderToWriter(out)
 	}
 
-	testset = deleteBroadcasterReader(testset, orig[0])
-	for _, br := range testset {
-		if br == orig[0] {
-			t.Error("Failed to delete first/only element")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-release // blocked until the broadcast completes
+		var err error
+		if heavyOut, err = ioutil.ReadAll(heavy); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("heavy reader applied backpressure to the broadcast")
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%d reader data mismatch", i)
 		}
 	}
 
+	close(release)
+	wg.Wait()
+
+	if !bytes.Equal(heavyOut, data) {
+		t.Error("data mismatch on heavy reader")
+	}
+
 }
 
-func BenchmarkBroadcaster(b *testing.B) {
+func TestBroadcasterTokenBucket(t *testing.T) {
 
 	const (
-		readerCt = 1
-		dataSize = 32 << 20
+		burst = 16 << 10
+		rate  = 160 << 10
+		size  = 48 << 10
+	)
+
+	b := NewBroadcaster(bytes.NewReader(make([]byte, size)))
+	b.ReadBufferSize = 4 << 10
+	b.BurstBytes = burst
+	b.SustainedBytesPerSec = rate
+
+	br := b.NewReader()
+
+	var (
+		burstTime time.Duration
+		done      = make(chan struct{})
 	)
 
+	go func() {
+		defer close(done)
+		start := time.Now()
+		buf := make([]byte, 4<<10)
+		var total int
+		for {
+			n, err := br.Read(buf)
+			total += n
+			if total >= burst && burstTime == 0 {
+				burstTime = time.Since(start)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+	elapsed := time.Since(start)
+	<-done
+
+	// (size-burst)/rate = 200ms
+	if elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected ~200ms at sustained rate, took %s", elapsed)
+	}
+	if burstTime > 100*time.Millisecond {
+		t.Errorf("Expected initial burst to be immediate, took %s", burstTime)
+	}
+
+	// abort unblocks a throttled read
+	b = NewBroadcaster(bytes.NewReader(make([]byte, size)))
+	b.SustainedBytesPerSec = 1
+	b.BurstBytes = 1
+	b.NewReader()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.Abort()
+	}()
+	start = time.Now()
+	if err := b.Broadcast(); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Abort took %s to unblock throttled read", elapsed)
+	}
+
+}
+
+func TestBroadcasterErrors(t *testing.T) {
+
+	testError := errors.New("test")
+
+	b := NewBroadcaster(&errorReader{err: testError})
+
+	br := b.NewReader()
+
+	go func() {
+		if err := b.Broadcast(); err != testError {
+			t.Errorf("Expected %q, got %q", testError, err)
+		}
+	}()
+
+	var buf [2]byte
+	if _, err := br.Read(buf[:]); err != testError {
+		t.Errorf("Expected %q, got %q", testError, err)
+	}
+
+	// close should not emit read error
+	if err := br.Close(); err != nil {
+		t.Error(err)
+	}
+
+}
+
+func TestBroadcasterSlowReaderTimeout(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 8
+	b.ReadChanLength = 1
+	b.SlowReaderTimeout = 10 * time.Millisecond
+
+	br := b.NewReader()
+
+	// Broadcast called synchronously with no reader being consumed
+	// is a usage error.  Without SlowReaderTimeout this deadlocks.
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast deadlocked on unconsumed reader")
+	}
+
+	// buffered data is still delivered before the error
+	out, err := ioutil.ReadAll(br)
+	if !errors.Is(err, ErrReaderTimedOut) {
+		t.Errorf("Expected %q, got %q", ErrReaderTimedOut, err)
+	}
+	var dropped *ReaderDroppedError
+	if !errors.As(err, &dropped) {
+		t.Fatalf("Expected *ReaderDroppedError, got %T", err)
+	}
+	if dropped.ID != br.ID() || dropped.Queued != 1 || dropped.Waited != b.SlowReaderTimeout {
+		t.Errorf("Expected reader %d dropped with 1 queued after %s, got %+v", br.ID(), b.SlowReaderTimeout, dropped)
+	}
+	if !bytes.Equal(out, data[:len(out)]) || len(out) == 0 {
+		t.Errorf("Expected prefix of data, got %q", out)
+	}
+
+	// a stalled reader does not stall a lock step broadcast
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 8
+	b.LockStep = true
+	b.SlowReaderTimeout = 10 * time.Millisecond
+
+	stalled := b.NewReader()
+	b.NewReaderToWriter(ioutil.Discard)
+
+	go func() { done <- b.Broadcast() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast stalled on lock step reader")
+	}
+
+	if _, err := ioutil.ReadAll(stalled); !errors.Is(err, ErrReaderTimedOut) {
+		t.Errorf("Expected %q, got %q", ErrReaderTimedOut, err)
+	}
+
+}
+
+func TestBroadcasterMaxReaderBacklog(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 4
+	b.MaxReaderBacklog = 1000
+	slow := b.NewUnbufferedSafeReader()
+	// bounded by ReadChanLength well within MaxReaderBacklog
+	fast := b.NewReader()
+	// keeps up, so is never dropped however much it receives
+	c, errFunc, _ := b.NewChannelReader()
+
+	received := make(chan []byte, 1)
+	go func() {
+		var got []byte
+		for p := range c {
+			got = append(got, p...)
+		}
+		received <- got
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	if got, err := ioutil.ReadAll(fast); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if got := <-received; !bytes.Equal(got, data) || errFunc() != nil {
+		t.Errorf("Expected %d bytes of data over the channel, got %d and %v", len(data), len(got), errFunc())
+	}
+
+	// the unread data is discarded
+	for i := 0; i < 2; i++ {
+		if n, err := slow.Read(make([]byte, 100)); n != 0 || err != ErrBacklogExceeded {
+			t.Errorf("Expected %q, got %d bytes and %v", ErrBacklogExceeded, n, err)
+		}
+	}
+
+}
+
+func TestBroadcasterMinReaders(t *testing.T) {
+
+	var reads int32
+
+	src := bytes.NewReader(data)
+	b := NewBroadcaster(readerFunc(func(p []byte) (int, error) {
+		atomic.AddInt32(&reads, 1)
+		return src.Read(p)
+	}))
+	b.MinReaders = 3
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	var (
+		wg  sync.WaitGroup
+		got = make([][]byte, 3)
+	)
+	for i := range got {
+		br := b.NewReader()
+		if i < 2 {
+			time.Sleep(20 * time.Millisecond)
+			if n := atomic.LoadInt32(&reads); n != 0 {
+				t.Errorf("Expected no reads with %d readers, got %d", i+1, n)
+			}
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], _ = ioutil.ReadAll(br)
+		}(i)
+	}
+
+	wg.Wait()
+	for i := range got {
+		if !bytes.Equal(got[i], data) {
+			t.Errorf("Expected reader %d to receive %d bytes, got %d", i, len(data), len(got[i]))
+		}
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// Abort interrupts the wait
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.MinReaders = 1
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		b.Abort()
+	}()
+	if err := b.Broadcast(); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+}
+
+func TestBroadcasterBackpressure(t *testing.T) {
+
+	// the segments held when the slow reader's channel is full
+	last := (len(data) - 1) / 100 * 100
+	held := map[BackpressurePolicy][]byte{
+		DropSlow:   data[:200],
+		DropOldest: data[last-100:],
+	}
+
+	for policy, want := range held {
+		b := NewBroadcaster(bytes.NewReader(data))
+		b.ReadBufferSize = 100
+		b.ReadChanLength = 2
+		b.Backpressure = policy
+		slow := b.NewReader()
+		// never fills, so receives everything
+		var fast bytes.Buffer
+		fastr := b.NewUnbufferedSafeReader()
+		copied := make(chan struct{})
+		go func() {
+			defer close(copied)
+			io.Copy(&fast, fastr)
+		}()
+
+		// the slow reader does not read until the broadcast ends
+		if err := b.Broadcast(); err != nil {
+			t.Fatal(err)
+		}
+		<-copied
+		if !bytes.Equal(fast.Bytes(), data) {
+			t.Errorf("Expected the fast reader to receive %d bytes, got %d", len(data), fast.Len())
+		}
+
+		got, err := ioutil.ReadAll(slow)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d: Expected %d bytes held, got %d", policy, len(want), len(got))
+		}
+		if n := slow.Dropped(); n != int64(len(data)-len(want)) {
+			t.Errorf("%d: Expected %d bytes dropped, got %d", policy, len(data)-len(want), n)
+		}
+	}
+
+}
+
+func TestBroadcasterReadContext(t *testing.T) {
+
+	pr, pw := io.Pipe()
+
+	b := NewBroadcaster(pr)
+	b.ReadBufferSize = 4
+	br := b.NewReader()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	buf := make([]byte, 16)
+
+	// the source is slow, so the read times out
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := br.ReadContext(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("Expected %q, got %q", context.DeadlineExceeded, err)
+	}
+
+	// the reader remains in the broadcast
+	go pw.Write([]byte("late"))
+	n, err := br.ReadContext(context.Background(), buf[:4])
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != "late" {
+		t.Errorf("Expected %q, got %q", "late", buf[:n])
+	}
+
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// EOF takes precedence over a done context
+	if _, err := br.ReadContext(ctx, buf); err != io.EOF {
+		t.Errorf("Expected %q, got %q", io.EOF, err)
+	}
+
+	// as does Abort
+	b = NewBroadcaster(&sleepyReader{bytes.NewReader(data)})
+	br = b.NewReader()
+	b.Abort()
+	if _, err := br.ReadContext(ctx, buf); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+}
+
+func TestBroadcasterSetReadDeadline(t *testing.T) {
+
+	pr, pw := io.Pipe()
+
+	b := NewBroadcaster(pr)
+	b.ReadBufferSize = 4
+	br := b.NewReader()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	buf := make([]byte, 4)
+
+	br.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := br.Read(buf); err != os.ErrDeadlineExceeded {
+		t.Errorf("Expected %q, got %q", os.ErrDeadlineExceeded, err)
+	}
+
+	// data arriving after the deadline is not lost
+	go pw.Write([]byte("late"))
+	time.Sleep(20 * time.Millisecond)
+	br.SetReadDeadline(time.Time{})
+	n, err := br.Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != "late" {
+		t.Errorf("Expected %q, got %q", "late", buf[:n])
+	}
+
+	pw.Close()
+	if _, err := br.Read(buf); err != io.EOF {
+		t.Errorf("Expected %q, got %q", io.EOF, err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+}
+
+func TestBroadcasterReplaceSource(t *testing.T) {
+
+	var (
+		primary = errors.New("primary failed")
+		half    = len(data) / 2
+		backup  = bytes.NewReader(data[half:])
+	)
+
+	b := NewBroadcaster(io.MultiReader(bytes.NewReader(data[:half]), &errorReader{err: primary}))
+	b.ReadBufferSize = 100
+	b.ErrorPolicy = func(err error) ErrorAction {
+		if err == primary {
+			b.ReplaceSource(backup)
+			return ErrorIgnore
+		}
+		return ErrorPropagate
+	}
+
+	outputs := []*bytes.Buffer{
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	}
+	for _, out := range outputs {
+		b.NewReaderToWriter(out)
+	}
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%d reader data mismatch", i)
+		}
+	}
+
+}
+
+func TestBroadcasterPause(t *testing.T) {
+
+	var reads int32
+
+	src := bytes.NewReader(data)
+	b := NewBroadcaster(readerFunc(func(p []byte) (int, error) {
+		atomic.AddInt32(&reads, 1)
+		return src.Read(p)
+	}))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 4
+	br := b.NewReader()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	got := make([]byte, 100)
+	if _, err := io.ReadFull(br, got); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Pause()
+
+	// drain what was read before the pause
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		buf := make([]byte, 100)
+		n, err := br.ReadContext(ctx, buf)
+		cancel()
+		got = append(got, buf[:n]...)
+		if err == context.DeadlineExceeded {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paused := atomic.LoadInt32(&reads)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&reads); n != paused {
+		t.Errorf("Expected no reads while paused, got %d", n-paused)
+	}
+
+	b.Resume()
+
+	rest, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Error(err)
+	}
+	if got = append(got, rest...); !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// repeated pauses leave the readers' channels open
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	br = b.NewReader()
+	go func() { done <- b.Broadcast() }()
+	go func(b *Broadcaster) {
+		for i := 0; i < 5; i++ {
+			b.Pause()
+			b.Pause()
+			time.Sleep(time.Millisecond)
+			b.Resume()
+			b.Resume()
+		}
+	}(b)
+	if got, err := ioutil.ReadAll(br); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// Abort interrupts a paused broadcast and its waiting readers
+	b = NewBroadcaster(bytes.NewReader(data))
+	br = b.NewReader()
+	b.Pause()
+	go func() { done <- b.Broadcast() }()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		b.Abort()
+	}()
+	if _, err := br.Read(make([]byte, 100)); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+	if err := <-done; err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+}
+
+func TestBroadcasterSetPriority(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 8
+	b.ReadChanLength = 1
+
+	// low is never read, so the broadcast stalls on it once its
+	// channel is full
+	low := b.NewReader()
+	high := b.NewReader()
+	high.SetPriority(1)
+
+	go b.Broadcast()
+	defer b.Abort()
+
+	// high receives the segment the broadcast stalls on
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buf := make([]byte, 16)
+	for n := 0; n < len(buf); {
+		nn, err := high.ReadContext(ctx, buf[n:])
+		if err != nil {
+			t.Fatalf("Expected high priority reader to stay current, got %v after %d bytes", err, n)
+		}
+		n += nn
+	}
+	if !bytes.Equal(buf, data[:16]) {
+		t.Error("buf/data mismatch")
+	}
+
+	// a high priority reader is not dropped for being slow
+	b = NewBroadcaster(bytes.NewReader(data[:64]))
+	b.ReadBufferSize = 8
+	b.ReadChanLength = 1
+	b.SlowReaderTimeout = 10 * time.Millisecond
+
+	low = b.NewReader()
+	high = b.NewReader()
+	high.SetPriority(1)
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	time.Sleep(50 * time.Millisecond)
+	out, err := ioutil.ReadAll(high)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(out, data[:64]) {
+		t.Error("buf/data mismatch")
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if _, err := ioutil.ReadAll(low); !errors.Is(err, ErrReaderTimedOut) {
+		t.Errorf("Expected %q, got %q", ErrReaderTimedOut, err)
+	}
+
+}
+
+func TestBroadcasterErrorPolicy(t *testing.T) {
+
+	testError := errors.New("transient")
+
+	var retries int
+
+	b := NewBroadcaster(&flakyReader{Reader: bytes.NewReader(data), err: testError, failures: 2})
+	b.ErrorPolicy = func(err error) ErrorAction {
+		if err == testError && retries < 3 {
+			retries++
+			return ErrorIgnore
+		}
+		return ErrorPropagate
+	}
+
+	br := b.NewReader()
+
+	var out []byte
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		out, err = ioutil.ReadAll(br)
+		done <- err
+	}()
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if retries != 2 {
+		t.Errorf("Expected %d retries, got %d", 2, retries)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("data mismatch")
+	}
+
+	// policy gives up and aborts
+	b = NewBroadcaster(&flakyReader{Reader: bytes.NewReader(data), err: testError, failures: 2})
+	b.ErrorPolicy = func(err error) ErrorAction { return ErrorAbort }
+	br = b.NewReader()
+	go func() {
+		_, err := ioutil.ReadAll(br)
+		done <- err
+	}()
+	if err := b.Broadcast(); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+	if err := <-done; err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+	// aborting again after the policy aborted must not panic
+	b.Abort()
+
+}
+
+func TestBroadcasterNewChannelReader(t *testing.T) {
+
+	testdata := make([]byte, (1<<20)+21)
+	rand.Read(testdata)
+
+	b := NewBroadcaster(bytes.NewReader(testdata))
+	c, errFunc, _ := b.NewChannelReader()
+	b.NewReaderToWriter(ioutil.Discard)
+
+	done := make(chan []byte)
+	go func() {
+		var out []byte
+		for data := range c {
+			out = append(out, data...)
+		}
+		done <- out
+	}()
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+	if out := <-done; !bytes.Equal(out, testdata) {
+		t.Error("data mismatch")
+	}
+	if err := errFunc(); err != nil {
+		t.Error(err)
+	}
+
+	// abort closes the channel
+	b = NewBroadcaster(&sleepyReader{bytes.NewReader(data)})
+	c, errFunc, _ = b.NewChannelReader()
+	b.Abort()
+	b.Broadcast()
+	for range c {
+	}
+	if err := errFunc(); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+	// a consumer that stops receiving cancels without blocking the broadcast
+	b = NewBroadcaster(bytes.NewReader(testdata))
+	b.ReadBufferSize = 1 << 10
+	c, errFunc, cancel := b.NewChannelReader()
+	b.NewReaderToWriter(ioutil.Discard)
+
+	go func() {
+		<-c
+		cancel()
+		cancel()
+	}()
+
+	broadcastDone := make(chan error, 1)
+	go func() { broadcastDone <- b.Broadcast() }()
+
+	select {
+	case err := <-broadcastDone:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled channel reader blocked the broadcast")
+	}
+	for range c {
+	}
+	if err := errFunc(); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+}
+
+func TestBroadcasterNewReaderToWriter(t *testing.T) {
+
+	testdata := make([]byte, (1<<20)+21)
+	rand.Read(testdata)
+
+	b := NewBroadcaster(bytes.NewReader(testdata))
+
+	outputs := []*bytes.Buffer{
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	}
+	for _, out := range outputs {
+		b.NewReaderToWriter(out)
+	}
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), testdata) {
+			t.Errorf("%d writer data mismatch", i)
+		}
+	}
+
+	// a failing writer is reported without disrupting the others
+	b = NewBroadcaster(bytes.NewReader(testdata))
+	out := &bytes.Buffer{}
+	b.NewReaderToWriter(struct{ io.Writer }{&testErrorWriter{}}) // hide ReadFrom
+	b.NewReaderToWriter(out)
+
+	if err := b.Broadcast(); err != writeErr {
+		t.Errorf("Expected %q, got %q", writeErr, err)
+	}
+	if !bytes.Equal(out.Bytes(), testdata) {
+		t.Error("data mismatch")
+	}
+
+	// source errors take precedence
+	testError := errors.New("test")
+	b = NewBroadcaster(&errorReader{err: testError})
+	b.NewReaderToWriter(&bytes.Buffer{})
+	if err := b.Broadcast(); err != testError {
+		t.Errorf("Expected %q, got %q", testError, err)
+	}
+
+}
+
+func TestBroadcasterBroadcastTo(t *testing.T) {
+
+	outputs := []*bytes.Buffer{
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	}
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	if err := b.BroadcastTo(outputs[0], outputs[1], outputs[2]); err != nil {
+		t.Error(err)
+	}
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%d writer data mismatch", i)
+		}
+	}
+
+	// a failed writer is reported without stopping the others
+	out := &bytes.Buffer{}
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 16
+	// hides the ReadFrom of the embedded bytes.Buffer from io.Copy
+	failed := struct{ io.Writer }{&testErrorWriter{}}
+	if err := b.BroadcastTo(failed, out); err != writeErr {
+		t.Errorf("Expected %q, got %q", writeErr, err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("writer data mismatch")
+	}
+
+	// abort is honored
+	b = NewBroadcaster(&sleepyReader{bytes.NewReader(data)})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.Abort()
+	}()
+	if err := b.BroadcastTo(ioutil.Discard, ioutil.Discard); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+}
+
+func TestBroadcasterBroadcastToDetailed(t *testing.T) {
+
+	var (
+		ok   bytes.Buffer
+		errA = errors.New("sink a failed")
+		errB = errors.New("sink b failed")
+	)
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	res := b.BroadcastToDetailed(
+		writerFunc(func(p []byte) (int, error) { return 0, errA }),
+		&ok,
+		writerFunc(func(p []byte) (int, error) { return 0, errB }),
+	)
+
+	if res.Source != nil {
+		t.Error(res.Source)
+	}
+	if len(res.Writers) != 3 || res.Writers[0] != errA || res.Writers[1] != nil || res.Writers[2] != errB {
+		t.Errorf("Expected [%v <nil> %v], got %v", errA, errB, res.Writers)
+	}
+	if err := res.Err(); !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Expected both errors, got %v", err)
+	}
+	if !bytes.Equal(ok.Bytes(), data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), ok.Len())
+	}
+
+}
+
+func TestBroadcasterChecksum(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 64
+	b.Hash = sha256.New()
+
+	var (
+		brs  = []*BroadcasterReader{b.NewReader(), b.NewReader()}
+		wg   sync.WaitGroup
+		want = sha256.Sum256(data)
+	)
+
+	for _, br := range brs {
+		wg.Add(1)
+		go func(br *BroadcasterReader) {
+			defer wg.Done()
+			if br.Checksum() != nil {
+				t.Error("Expected no checksum before EOF")
+			}
+			if _, err := io.Copy(ioutil.Discard, br); err != nil {
+				t.Error(err)
+			}
+			if !bytes.Equal(br.Checksum(), want[:]) {
+				t.Errorf("Expected checksum %x, got %x", want, br.Checksum())
+			}
+		}(br)
+	}
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+
+}
+
+func TestLimitedBroadcaster(t *testing.T) {
+
+	const limit = 100
+
+	src := bytes.NewReader(data)
+
+	b := NewLimitedBroadcaster(src, limit)
+	b.ReadBufferSize = 64
+
+	outputs := []*bytes.Buffer{
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	}
+	if err := b.BroadcastTo(outputs[0], outputs[1]); err != nil {
+		t.Error(err)
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), data[:limit]) {
+			t.Errorf("%d reader: expected %d bytes, got %d", i, limit, out.Len())
+		}
+	}
+	if read := src.Size() - int64(src.Len()); read != limit {
+		t.Errorf("Expected %d bytes read from the source, got %d", limit, read)
+	}
+
+}
+
+func TestBroadcasterReset(t *testing.T) {
+
+	pr, pw := io.Pipe()
+
+	var (
+		b   = NewBroadcaster(pr)
+		out = &bytes.Buffer{}
+		br  = b.NewReader()
+	)
+	b.NewReaderToWriter(out)
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	pw.Write([]byte("first"))
+	if err := b.Reset(bytes.NewReader(nil)); err != ErrInProgress {
+		t.Errorf("Expected %q, got %q", ErrInProgress, err)
+	}
+	pw.Close()
+
+	for _, src := range []string{"first", "second", "third"} {
+		got, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(got) != src {
+			t.Errorf("Expected %q, got %q", src, got)
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		if out.String() != src {
+			t.Errorf("Expected %q, got %q", src, out.String())
+		}
+		out.Reset()
+
+		next := map[string]string{"first": "second", "second": "third"}[src]
+		if err := b.Reset(strings.NewReader(next)); err != nil {
+			t.Error(err)
+		}
+		if status, _ := b.Status(); status != BroadcastPending {
+			t.Errorf("Expected %s, got %s", BroadcastPending, status)
+		}
+		go func() { done <- b.Broadcast() }()
+	}
+
+	ioutil.ReadAll(br)
+	<-done
+
+}
+
+func TestBroadcasterResetChannelReader(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	c, errFunc, _ := b.NewChannelReader()
+	br := b.NewReader()
+
+	var (
+		done = make(chan error, 1)
+		read = make(chan struct{})
+	)
+	go func() { done <- b.Broadcast() }()
+	go func() {
+		defer close(read)
+		ioutil.ReadAll(br)
+	}()
+
+	var got []byte
+	for p := range c {
+		got = append(got, p...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes, got %d", len(data), len(got))
+	}
+	if err := errFunc(); err != nil {
+		t.Error(err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	// readers must not be read during Reset
+	<-read
+
+	// the channel reader, closed with its channel, is not re-armed
+	if err := b.Reset(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.ActiveReaders(); n != 1 {
+		t.Errorf("Expected 1 reader, got %d", n)
+	}
+	go func() { done <- b.Broadcast() }()
+	if got, err := ioutil.ReadAll(br); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes, got %d and %v", len(data), len(got), err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast after Reset did not return")
+	}
+
+}
+
+func TestBroadcasterBroadcastStats(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	b.SlowReaderTimeout = 10 * time.Millisecond
+	b.NewReader() // dropped for never reading
+	b.NewReader().Close()
+	br := b.NewReader()
+	br.SetPriority(1)
+
+	go io.Copy(ioutil.Discard, br)
+
+	stats, err := b.BroadcastStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.BytesRead != int64(len(data)) || stats.ReadersServed != 3 || stats.ReadersDropped != 1 || stats.Elapsed <= 0 {
+		t.Errorf("Expected %d bytes, 3 readers and 1 dropped, got %+v", len(data), stats)
+	}
+
+	// partway through an abort
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	br = b.NewReader()
+	go func() {
+		br.Read(make([]byte, 100))
+		b.Abort()
+	}()
+
+	stats, err = b.BroadcastStats()
+	if err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+	if stats.BytesRead != b.TotalBytesBroadcast() || stats.BytesRead == 0 || stats.ReadersServed != 1 {
+		t.Errorf("Expected %d bytes and 1 reader, got %+v", b.TotalBytesBroadcast(), stats)
+	}
+
+}
+
+type recordingMetrics struct {
+	read  int
+	lags  map[int]int // calls per reader
+	drops []int
+	lag   map[int]int // last lag per reader, if not nil
+}
+
+func (m *recordingMetrics) RecordRead(n int) {
+	m.read += n
+}
+
+func (m *recordingMetrics) RecordReaderLag(id int, n int) {
+	m.lags[id]++
+	if m.lag != nil {
+		m.lag[id] = n
+	}
+}
+
+func (m *recordingMetrics) RecordDrop(id int) {
+	m.drops = append(m.drops, id)
+}
+
+func TestBroadcasterMetrics(t *testing.T) {
+
+	m := &recordingMetrics{lags: make(map[int]int)}
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	b.SlowReaderTimeout = 10 * time.Millisecond
+	b.Metrics = m
+	slow := b.NewReader() // dropped for never reading
+	br := b.NewReader()
+	br.SetPriority(1)
+
+	go io.Copy(ioutil.Discard, br)
+
+	if err := b.Broadcast(); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.read != len(data) {
+		t.Errorf("Expected %d bytes read, got %d", len(data), m.read)
+	}
+	segments := (len(data) + b.ReadBufferSize - 1) / b.ReadBufferSize
+	if m.lags[br.ID()] != segments {
+		t.Errorf("Expected %d lags of reader %d, got %d", segments, br.ID(), m.lags[br.ID()])
+	}
+	if n := m.lags[slow.ID()]; n == 0 || n >= segments {
+		t.Errorf("Expected lags of reader %d until dropped, got %d", slow.ID(), n)
+	}
+	if len(m.drops) != 1 || m.drops[0] != slow.ID() {
+		t.Errorf("Expected reader %d dropped, got %v", slow.ID(), m.drops)
+	}
+
+	// the lag of a reader whose segments are queued includes the queue
+	m = &recordingMetrics{lags: make(map[int]int), lag: make(map[int]int)}
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.ReadChanLength = 1
+	b.Metrics = m
+	br = b.NewUnbufferedSafeReader()
+	if err := b.Broadcast(); err != nil {
+		t.Fatal(err)
+	}
+	if m.lag[br.ID()] != segments {
+		t.Errorf("Expected a lag of %d segments, got %d", segments, m.lag[br.ID()])
+	}
+	if out, err := ioutil.ReadAll(br); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("Expected %d bytes, got %d and %v", len(data), len(out), err)
+	}
+	if n := br.lag(); n != 0 {
+		t.Errorf("Expected no lag once read, got %d", n)
+	}
+
+	// nil is treated as NopMetrics
+	b = NewBroadcaster(bytes.NewReader(data))
+	b.Metrics = nil
+	go io.Copy(ioutil.Discard, b.NewReader())
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+
+}
+
+func TestBroadcasterVerifyMode(t *testing.T) {
+
+	for _, perReaderCopy := range []bool{false, true} {
+		b := NewBroadcaster(bytes.NewReader(data))
+		b.ReadBufferSize = 100
+		b.VerifyMode = true
+		b.PerReaderCopy = perReaderCopy
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			br := b.NewReader()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := io.Copy(ioutil.Discard, br); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		if err := b.Broadcast(); err != nil {
+			t.Error(err)
+		}
+		wg.Wait()
+	}
+
+	// segments injected directly, as a faulty fanout would send them
+	for _, test := range []struct {
+		name string
+		seqs []uint64
+	}{
+		{"gap", []uint64{1, 2, 4}},
+		{"duplicate", []uint64{5, 6, 6}},
+		{"reordered", []uint64{2, 3, 1}},
+	} {
+		b := NewBroadcaster(bytes.NewReader(nil))
+		b.VerifyMode = true
+		br := b.NewReader()
+		for _, seq := range test.seqs {
+			br.in <- &broadcastBuffer{data: []byte("segment"), refs: 1, seq: seq}
+		}
+		p := make([]byte, len("segment"))
+		for i := range test.seqs[:len(test.seqs)-1] {
+			if _, err := br.Read(p); err != nil {
+				t.Fatalf("%s: segment %d: %v", test.name, i, err)
+			}
+		}
+		want := &SequenceError{
+			ID:       br.ID(),
+			Expected: test.seqs[len(test.seqs)-2] + 1,
+			Got:      test.seqs[len(test.seqs)-1],
+		}
+		for i := 0; i < 2; i++ {
+			_, err := br.Read(p)
+			if se, ok := err.(*SequenceError); !ok || *se != *want || !errors.Is(err, ErrOutOfSequence) {
+				t.Errorf("%s: Expected %v, got %v", test.name, want, err)
+			}
+		}
+	}
+
+}
+
+func TestBroadcasterStatus(t *testing.T) {
+
+	testError := errors.New("test")
+
+	for _, test := range []struct {
+		r      io.Reader
+		abort  bool
+		status BroadcastStatus
+		err    error
+	}{
+		{r: bytes.NewReader(data), status: BroadcastCompleted},
+		{r: &sleepyReader{bytes.NewReader(data)}, abort: true, status: BroadcastAborted},
+		{r: &errorReader{err: testError}, status: BroadcastFailed, err: testError},
+	} {
+
+		b := NewBroadcaster(test.r)
+		b.NewReaderToWriter(ioutil.Discard)
+
+		if status, err := b.Status(); status != BroadcastPending || err != nil {
+			t.Errorf("Expected %s, got %s (%v)", BroadcastPending, status, err)
+		}
+
+		if test.abort {
+			b.Abort()
+		}
+		b.Broadcast()
+
+		if status, err := b.Status(); status != test.status || err != test.err {
+			t.Errorf("Expected %s (%v), got %s (%v)", test.status, test.err, status, err)
+		}
+
+	}
+
+}
+
+func TestBroadcasterMaxInFlightBuffers(t *testing.T) {
+
+	const (
+		bufferSize = 1 << 10
+		maxBuffers = 4
+		readerCt   = 3
+	)
+
+	buf := make([]byte, 64*bufferSize)
+	rand.Read(buf)
+
+	var (
+		src      = bytes.NewReader(buf)
+		consumed [readerCt]int64
+		maxLag   int64
+		wg       sync.WaitGroup
+	)
+
+	// measure how far the source gets ahead of the slowest reader
+	b := NewBroadcaster(readerFunc(func(p []byte) (int, error) {
+		n, err := src.Read(p)
+		min := atomic.LoadInt64(&consumed[0])
+		for i := range consumed {
+			if c := atomic.LoadInt64(&consumed[i]); c < min {
+				min = c
+			}
+		}
+		if lag := int64(len(buf)-src.Len()) - min; lag > maxLag {
+			maxLag = lag
+		}
+		return n, err
+	}))
+	b.ReadBufferSize = bufferSize
+	b.MaxInFlightBuffers = maxBuffers
+
+	for i := 0; i < readerCt; i++ {
+		br := b.NewReader()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var out []byte
+			p := make([]byte, bufferSize)
+			for {
+				time.Sleep(100 * time.Microsecond)
+				n, err := br.Read(p)
+				out = append(out, p[:n]...)
+				atomic.AddInt64(&consumed[i], int64(n))
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if !bytes.Equal(out, buf) {
+				t.Errorf("%d reader data mismatch", i)
+			}
+		}(i)
+	}
+
+	// closed readers must not hold their buffers
+	for _, br := range []*BroadcasterReader{b.NewReader(), b.NewUnbufferedSafeReader()} {
+		wg.Add(1)
+		go func(br *BroadcasterReader) {
+			defer wg.Done()
+			br.Read(make([]byte, 1))
+			br.Close()
+		}(br)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast stalled waiting for buffers")
+	}
+
+	wg.Wait()
+
+	if limit := int64((maxBuffers + 1) * bufferSize); maxLag > limit {
+		t.Errorf("Expected source at most %d bytes ahead, got %d", limit, maxLag)
+	}
+
+}
+
+func TestBroadcasterUseWriterTo(t *testing.T) {
+
+	testdata := make([]byte, (1<<20)+21)
+	rand.Read(testdata)
+
+	b := NewBroadcaster(bytes.NewReader(testdata))
+	b.UseWriterTo = true
+	b.ReadChanLength = 1
+
+	outputs := []*bytes.Buffer{
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	}
+	for _, out := range outputs {
+		b.NewReaderToWriter(out)
+	}
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), testdata) {
+			t.Errorf("%d reader data mismatch", i)
+		}
+	}
+
+	// abort stops the WriteTo
+	b = NewBroadcaster(bytes.NewReader(testdata))
+	b.UseWriterTo = true
+	b.NewReader()
+	b.Abort()
+	if err := b.Broadcast(); err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+	// including once it has started writing
+	b = NewBroadcaster(bytes.NewReader(testdata))
+	b.UseWriterTo = true
+	b.ReadChanLength = 1
+	br := b.NewReader()
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+	if _, err := br.Read(make([]byte, 1)); err != nil {
+		t.Error(err)
+	}
+	b.Abort()
+	if err := <-done; err != ErrAborted {
+		t.Errorf("Expected %q, got %q", ErrAborted, err)
+	}
+
+	// in-memory sources use WriteTo without UseWriterTo
+	for _, r := range []io.Reader{bytes.NewReader(testdata), strings.NewReader(string(testdata)), bytes.NewBuffer(testdata)} {
+		b = NewBroadcaster(r)
+		if _, ok := b.writerTo(); !ok {
+			t.Errorf("Expected WriteTo to be used for %T", r)
+		}
+		var out bytes.Buffer
+		b.NewReaderToWriter(&out)
+		if err := b.Broadcast(); err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(out.Bytes(), testdata) {
+			t.Errorf("%T data mismatch", r)
+		}
+	}
+
+	// unless reads are subject to ErrorPolicy or a rate limit
+	b = NewBroadcaster(bytes.NewReader(testdata))
+	b.ErrorPolicy = func(err error) ErrorAction { return ErrorPropagate }
+	if _, ok := b.writerTo(); ok {
+		t.Error("Expected no WriteTo with an ErrorPolicy")
+	}
+	b = NewBroadcaster(bytes.NewReader(testdata))
+	b.SustainedBytesPerSec = 1 << 20
+	if _, ok := b.writerTo(); ok {
+		t.Error("Expected no WriteTo with SustainedBytesPerSec")
+	}
+
+	// or the io.WriterTo does not hold its data in memory
+	if _, ok := NewBroadcaster(bufio.NewReader(bytes.NewReader(testdata))).writerTo(); ok {
+		t.Error("Expected no WriteTo for a *bufio.Reader")
+	}
+
+}
+
+func TestBroadcasterLockStep(t *testing.T) {
+
+	const (
+		bufferSize = 1 << 10
+		readerCt   = 3
+	)
+
+	buf := make([]byte, 64*bufferSize)
+	rand.Read(buf)
+
+	var (
+		consumed [readerCt]int64
+		wg       sync.WaitGroup
+	)
+
+	b := NewBroadcaster(bytes.NewReader(buf))
+	b.ReadBufferSize = bufferSize
+	b.LockStep = true
+
+	for i := 0; i < readerCt; i++ {
+		br := b.NewReader()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var out []byte
+			p := make([]byte, bufferSize)
+			for {
+				// readers run at different speeds
+				time.Sleep(time.Duration(i*100) * time.Microsecond)
+				n, err := br.Read(p)
+				out = append(out, p[:n]...)
+				c := atomic.AddInt64(&consumed[i], int64(n))
+				for j := range consumed {
+					// a reader may have received the next segment
+					// before another counts the current one
+					if skew := c - atomic.LoadInt64(&consumed[j]); skew > 2*bufferSize {
+						t.Errorf("reader %d is %d bytes ahead of reader %d", i, skew, j)
+					}
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if !bytes.Equal(out, buf) {
+				t.Errorf("%d reader data mismatch", i)
+			}
+		}(i)
+	}
+
+	// a closed reader does not stall the others
+	br := b.NewReader()
+	go func() {
+		br.Read(make([]byte, bufferSize))
+		br.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock step broadcast stalled")
+	}
+
+	wg.Wait()
+
+}
+
+func TestBroadcasterPerReaderCopy(t *testing.T) {
+
+	testdata := make([]byte, (1<<20)+21)
+	rand.Read(testdata)
+
+	for _, lockStep := range []bool{false, true} {
+
+		b := NewBroadcaster(bytes.NewReader(testdata))
+		b.PerReaderCopy = true
+		b.LockStep = lockStep
+		b.MaxInFlightBuffers = 2
+
+		outputs := []*bytes.Buffer{
+			&bytes.Buffer{},
+			&bytes.Buffer{},
+		}
+		for _, out := range outputs {
+			b.NewReaderToWriter(out)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- b.Broadcast() }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("broadcast stalled")
+		}
+
+		for i, out := range outputs {
+			if !bytes.Equal(out.Bytes(), testdata) {
+				t.Errorf("%d reader data mismatch", i)
+			}
+		}
+
+	}
+
+}
+
+func TestBroadcasterCountingReader(t *testing.T) {
+
+	testdata := make([]byte, (1<<20)+21)
+	rand.Read(testdata)
+
+	b := NewBroadcaster(bytes.NewReader(testdata))
+	cr := b.NewCountingReader()
+
+	out := &bytes.Buffer{}
+	b.NewReaderToWriter(out)
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+
+	if cr.Count() != int64(len(testdata)) {
+		t.Errorf("Expected count %d, got %d", len(testdata), cr.Count())
+	}
+	if !bytes.Equal(out.Bytes(), testdata) {
+		t.Error("data mismatch")
+	}
+
+}
+
+func TestBroadcasterOnProgress(t *testing.T) {
+
+	var totals []int64
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+	b.OnProgress(1000, func(total int64) {
+		totals = append(totals, total)
+	})
+	b.NewReaderToWriter(ioutil.Discard)
+
+	if err := b.Broadcast(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(totals) != len(data)/1000+1 {
+		t.Fatalf("Expected %d calls, got %d", len(data)/1000+1, len(totals))
+	}
+	for i, total := range totals[:len(totals)-1] {
+		if total != int64(i+1)*1000 {
+			t.Errorf("Expected call %d at %d bytes, got %d", i, (i+1)*1000, total)
+		}
+	}
+	if total := totals[len(totals)-1]; total != int64(len(data)) {
+		t.Errorf("Expected the final call at %d bytes, got %d", len(data), total)
+	}
+
+}
+
+func TestBroadcasterBytesRead(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 64
+
+	var (
+		fast = b.NewReader()
+		slow = b.NewReader()
+		buf  = make([]byte, 100)
+	)
+
+	done := make(chan error, 1)
+	go func() { done <- b.Broadcast() }()
+
+	// polled concurrently with the reads
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if fast.BytesRead() > b.TotalBytesBroadcast() {
+					t.Error("Expected reader to trail the broadcast")
+				}
+			}
+		}
+	}()
+	defer close(stop)
+
+	if _, err := io.ReadFull(slow, buf); err != nil {
+		t.Fatal(err)
+	}
+	slow.Close()
+	if _, err := io.Copy(ioutil.Discard, fast); err != nil {
+		t.Error(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if b.TotalBytesBroadcast() != int64(len(data)) {
+		t.Errorf("Expected %d bytes broadcast, got %d", len(data), b.TotalBytesBroadcast())
+	}
+	if fast.BytesRead() != int64(len(data)) {
+		t.Errorf("Expected %d bytes read, got %d", len(data), fast.BytesRead())
+	}
+	if slow.BytesRead() != int64(len(buf)) {
+		t.Errorf("Expected %d bytes read, got %d", len(buf), slow.BytesRead())
+	}
+
+}
+
+func TestBroadcasterAutoTuneReadChan(t *testing.T) {
+
+	buf := make([]byte, 256<<10)
+	rand.Read(buf)
+
+	b := NewBroadcaster(bytes.NewReader(buf))
+	b.ReadBufferSize = 1 << 10
+	b.ReadChanLength = 2
+	b.MaxReadChanLength = 64
+	b.AutoTuneReadChan = true
+
+	var (
+		slow, fast = b.NewReader(), b.NewReader()
+		slowMax    int
+		wg         sync.WaitGroup
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var out []byte
+		p := make([]byte, 1<<10)
+		for {
+			time.Sleep(50 * time.Microsecond)
+			if l := slow.ChanLength(); l > slowMax {
+				slowMax = l
+			}
+			n, err := slow.Read(p)
+			out = append(out, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if !bytes.Equal(out, buf) {
+			t.Error("slow reader data mismatch")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		out, err := ioutil.ReadAll(fast)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(out, buf) {
+			t.Error("fast reader data mismatch")
+		}
+	}()
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+
+	if slowMax <= b.ReadChanLength {
+		t.Errorf("Expected slow reader's queue to grow past %d, got %d", b.ReadChanLength, slowMax)
+	}
+	if slowMax > b.MaxReadChanLength {
+		t.Errorf("Expected slow reader's queue at most %d, got %d", b.MaxReadChanLength, slowMax)
+	}
+	if l := fast.ChanLength(); l >= b.ReadChanLength {
+		t.Errorf("Expected fast reader's queue to shrink below %d, got %d", b.ReadChanLength, l)
+	}
+
+}
+
+func TestMergeBroadcaster(t *testing.T) {
+
+	// distinguish the sources by the high bit
+	low, high := make([]byte, 200<<10), make([]byte, 150<<10)
+	for i := range low {
+		low[i] = byte(i % 0x80)
+	}
+	for i := range high {
+		high[i] = byte(0x80 + i%0x80)
+	}
+
+	b := NewMergeBroadcaster(bytes.NewReader(low), &sleepyReader{bytes.NewReader(high[:1<<10])}, bytes.NewReader(high[1<<10:]))
+
+	outputs := []*bytes.Buffer{
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	}
+	for _, out := range outputs {
+		b.NewReaderToWriter(out)
+	}
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), outputs[0].Bytes()) {
+			t.Errorf("%d reader received a different interleaving", i)
+		}
+	}
+
+	var gotLow []byte
+	for _, c := range outputs[0].Bytes() {
+		if c < 0x80 {
+			gotLow = append(gotLow, c)
+		}
+	}
+	if !bytes.Equal(gotLow, low) {
+		t.Error("source order not preserved")
+	}
+	if outputs[0].Len() != len(low)+len(high) {
+		t.Errorf("Expected %d bytes, got %d", len(low)+len(high), outputs[0].Len())
+	}
+
+	// an error from any source ends the broadcast
+	testError := errors.New("test")
+	b = NewMergeBroadcaster(&sleepyReader{bytes.NewReader(low)}, &errorReader{err: testError})
+	b.NewReaderToWriter(ioutil.Discard)
+	if err := b.Broadcast(); err != testError {
+		t.Errorf("Expected %q, got %q", testError, err)
+	}
+
+}
+
+func TestDeleteBroadcasterReader(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader([]byte{}))
+
+	orig := []*BroadcasterReader{
+		b.NewReader(),
+		b.NewReader(),
+		b.NewReader(),
+	}
+
+	testset := append([]*BroadcasterReader(nil), orig...)
+
+	testset = deleteBroadcasterReader(testset, orig[1])
+	for _, br := range testset {
+		if br == orig[1] {
+			t.Error("Failed to delete middle element")
+		}
+	}
+
+	testset = deleteBroadcasterReader(testset, orig[1])
+	for _, br := range testset {
+		if br == orig[1] {
+			t.Error("Failed to delete last element")
+		}
+	}
+
+	testset = deleteBroadcasterReader(testset, orig[0])
+	for _, br := range testset {
+		if br == orig[0] {
+			t.Error("Failed to delete first/only element")
+		}
+	}
+
+}
+
+func BenchmarkBroadcaster(b *testing.B) {
+	runBenchmarkBroadcaster(1, func(bc *Broadcaster) {}, b)
+}
+
+func BenchmarkBroadcasterUseWriterTo(b *testing.B) {
+	runBenchmarkBroadcaster(1, func(bc *Broadcaster) { bc.UseWriterTo = true }, b)
+}
+
+func BenchmarkBroadcasterShared4(b *testing.B) {
+	runBenchmarkBroadcaster(4, func(bc *Broadcaster) {}, b)
+}
+
+func BenchmarkBroadcasterPerReaderCopy4(b *testing.B) {
+	runBenchmarkBroadcaster(4, func(bc *Broadcaster) { bc.PerReaderCopy = true }, b)
+}
+
+func runBenchmarkBroadcaster(readerCt int, configure func(bc *Broadcaster), b *testing.B) {
+
+	const dataSize = 32 << 20
+
 	testdata := make([]byte, dataSize)
 	rand.Read(testdata)
 	b.SetBytes(dataSize)
+	b.ReportAllocs()
 
 	b.ResetTimer()
 
@@ -258,6 +2498,7 @@ func BenchmarkBroadcaster(b *testing.B) {
 		b.StopTimer()
 
 		bc := NewBroadcaster(bytes.NewReader(testdata))
+		configure(bc)
 
 		var wg sync.WaitGroup
 		wg.Add(readerCt)
@@ -6,6 +6,8 @@ import "errors"
 const (
 	// DefaultBufferSize is the default size used for internal buffers (8kb)
 	DefaultBufferSize = 8 << 10
+	// DefaultAsyncBufferSize is the default size of buffers read by an AsyncReader (2mb)
+	DefaultAsyncBufferSize = 2 << 20
 	// DefaultReadChanLength is the default size of channels used to buffer communication
 	DefaultReadChanLength = 32
 	// DefaultWriteChanLength is the default size of channels used to buffer communication
@@ -17,4 +19,28 @@ var (
 	ErrAborted = errors.New("aborted")
 	// ErrClosed indicates the requested service is closed
 	ErrClosed = errors.New("closed")
+	// ErrReaderTimedOut indicates a reader was removed from a
+	// broadcast for not keeping up with it
+	ErrReaderTimedOut = errors.New("reader timed out")
+	// ErrReentrant indicates a method was called from within a
+	// callback of the same object
+	ErrReentrant = errors.New("reentrant call")
+	// ErrCheckpointPending indicates a checkpoint of the same name
+	// has not yet been awaited
+	ErrCheckpointPending = errors.New("checkpoint pending")
+	// ErrUnknownWriter indicates no writer has the given ID
+	ErrUnknownWriter = errors.New("unknown writer")
+	// ErrInProgress indicates an operation is in progress
+	ErrInProgress = errors.New("in progress")
+	// ErrBufferLimit indicates a buffer would exceed its limit
+	ErrBufferLimit = errors.New("buffer limit exceeded")
+	// ErrBacklogExceeded indicates a reader was removed from a
+	// broadcast for leaving too much data unread
+	ErrBacklogExceeded = errors.New("backlog exceeded")
+	// ErrFrameTooLarge indicates data is too long for the length
+	// prefix of its frame
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrOutOfSequence indicates a reader received a segment of a
+	// broadcast out of order, twice or not at all
+	ErrOutOfSequence = errors.New("segment out of sequence")
 )
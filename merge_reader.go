@@ -0,0 +1,104 @@
+package extio
+
+import (
+	"io"
+	"sync"
+)
+
+type (
+	// mergeReader reads from several io.Readers concurrently and
+	// returns their data interleaved in the order it is read.
+	mergeReader struct {
+		c    chan segment
+		stop chan struct{}
+		once sync.Once
+		cur  []byte
+		err  error
+	}
+)
+
+// NewMergeBroadcaster creates a new Broadcaster that reads from
+// all of rs concurrently and broadcasts their data interleaved, as
+// when merging several feeds into one.  The data of each io.Reader
+// keeps its order, and each read from one is broadcast contiguously,
+// but the order between io.Readers is unspecified.  Every reader
+// of the broadcast receives the same interleaving.  The broadcast
+// ends with io.EOF once every io.Reader has, or with the first
+// other error returned by any of them.
+func NewMergeBroadcaster(rs ...io.Reader) *Broadcaster {
+
+	mr := &mergeReader{
+		c:    make(chan segment, len(rs)),
+		stop: make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+
+	for _, r := range rs {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			for {
+				buf := make([]byte, DefaultBufferSize)
+				n, err := r.Read(buf)
+				if err == io.EOF {
+					err = nil
+					if n == 0 {
+						return
+					}
+				}
+				select {
+				case mr.c <- segment{b: buf[:n], err: err}:
+				case <-mr.stop:
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(r)
+	}
+
+	go func() {
+		wg.Wait()
+		close(mr.c)
+	}()
+
+	return NewBroadcaster(mr)
+
+}
+
+// Read returns the data of the next read from any io.Reader, or
+// what remains of it.
+func (mr *mergeReader) Read(p []byte) (int, error) {
+
+	for len(mr.cur) == 0 {
+		if mr.err != nil {
+			return 0, mr.err
+		}
+		s, open := <-mr.c
+		if !open {
+			mr.err = io.EOF
+			continue
+		}
+		if s.err != nil {
+			mr.err = s.err
+			mr.close()
+		}
+		mr.cur = s.b
+	}
+
+	n := copy(p, mr.cur)
+	mr.cur = mr.cur[n:]
+
+	return n, nil
+
+}
+
+// close stops the io.Reader goroutines once each current read
+// returns.
+func (mr *mergeReader) close() {
+	mr.once.Do(func() {
+		close(mr.stop)
+	})
+}
@@ -1,8 +1,13 @@
 package extio
 
 import (
+	"encoding/binary"
+	"errors"
 	"io"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
@@ -10,74 +15,925 @@ type (
 	// allows for multiple io.Writers to be written to concurrently
 	// from a single write.  The functionality is similar to the
 	// io.MultiWriter except that each io.Writer receives it's data
-	// in a separate goroutine.
+	// in a separate goroutine.  Write, WriteAll and Close are
+	// safe for concurrent use.
+	//
+	// MultiWriters compose into trees: a MultiWriter may be one
+	// of the io.Writers of another, as may any io.WriteCloser such
+	// as the io.PipeWriter feeding a Broadcaster.  Closing the root
+	// closes each level only after it has drained the data sent to
+	// it, and does not return until every level below it has
+	// finished writing and closing.
 	MultiWriter struct {
 		writers []*mwWriter
 
 		WriteChanLength int
 
+		// DropOnFull causes data to be dropped for any io.Writer
+		// whose channel is full, rather than blocking Write until
+		// it has room.  A lossy io.Writer may detect the gaps by
+		// implementing SequenceWriter.  This must be set before
+		// the first Write. (default: false)
+		DropOnFull bool
+
+		// CoalesceSize, if greater than zero, accumulates Writes
+		// smaller than it into a single buffer that is sent to the
+		// io.Writers once it holds at least CoalesceSize bytes, or
+		// on Flush, WriteAll, Checkpoint or Close.  This trades
+		// latency for far fewer channel operations when writes are
+		// small.  Coalesced data is copied, and its sequence numbers
+		// count the buffers sent rather than the Writes.  This must
+		// be set before the first Write. (default: 0)
+		CoalesceSize int
+
+		// FlushInterval, if greater than zero, flushes the data
+		// accumulated by CoalesceSize at this interval, so that
+		// data written slowly still reaches the io.Writers within
+		// a bounded delay.  The timer runs from the first Write
+		// until Close.  This must be set before the first Write.
+		// (default: 0)
+		FlushInterval time.Duration
+
+		// ContinueOnError keeps writing to the remaining io.Writers
+		// when one fails, rather than failing each subsequent Write
+		// that reaches it.  The errors are still returned by Close.
+		// (default: false)
+		ContinueOnError bool
+
+		// DedupeWriters ignores an io.Writer that is already one of
+		// the MultiWriter's, so that building the set of io.Writers
+		// programmatically cannot deliver data to one twice.  AddWriter
+		// returns the ID of the io.Writer already present, and
+		// duplicates passed to NewMultiWriter are dropped at the first
+		// Write, leaving their IDs unknown.  io.Writers are compared
+		// with ==, and those of types that are not comparable are
+		// never considered duplicates.  This must be set before the
+		// first Write. (default: false)
+		DedupeWriters bool
+
+		// OnBackpressure, if set, is called with the ID of an
+		// io.Writer each time a Write finds its channel full and
+		// blocks until it has room, revealing which io.Writer is
+		// slowing the MultiWriter and whether WriteChanLength or
+		// DropOnFull would help.  It is called while the MultiWriter
+		// is locked, so it must be quick and must not call the
+		// MultiWriter's methods.  The fallback has the ID -1.
+		// (default: nil)
+		OnBackpressure func(id int)
+
+		fallback *mwWriter
+
+		pending []byte
+
+		seq         uint64
+		checkpoints map[string][]mwBarrier
+		nextID      int
+
+		mu     sync.Mutex
 		inited bool
 		closed bool
-		err    chan error
 		wg     sync.WaitGroup
+		stop   chan struct{}
+
+		errMu sync.Mutex
 	}
 
 	mwWriter struct {
-		w  io.Writer
-		wc chan []byte
+		n    int64 // bytes written, accessed atomically
+		id   int
+		w    io.Writer
+		enc  RecordEncoder // set for record writers
+		tier int
+		wc   chan mwChunk
+		done chan struct{}
+		err  error
+		errs []error
+
+		chain    []io.Writer // layers under w, closed after it
+		complete func(n int64, err error)
+
+		frame  int              // bytes of the length prefix, if framed
+		order  binary.ByteOrder // of the length prefix
+		framed []byte           // reused to prefix each chunk
+	}
+
+	// mwBarrier is a checkpoint's barrier sent to one io.Writer.
+	mwBarrier struct {
+		mww *mwWriter
+		ack chan struct{}
+	}
+
+	mwChunk struct {
+		seq    uint64
+		data   []byte
+		rec    interface{}
+		record bool          // rec is sent rather than data
+		ack    chan struct{} // closed when reached, if a barrier
+	}
+
+	// A SequenceWriter receives each chunk of data written to a
+	// MultiWriter along with its sequence number.  Sequence numbers
+	// start at zero and increase by one with each Write (and each
+	// chunk of a WriteAll) to the MultiWriter, so they are the same
+	// for every io.Writer receiving that data.  An io.Writer that
+	// implements SequenceWriter has WriteSequence called in place
+	// of Write, allowing it to detect chunks dropped by DropOnFull.
+	SequenceWriter interface {
+		WriteSequence(seq uint64, data []byte) (int, error)
+	}
+
+	// mwPipe is the io.Writer of a reader created by NewReader,
+	// buffering up to max bytes for it.
+	mwPipe struct {
+		mu      sync.Mutex
+		cond    sync.Cond
+		buf     []byte
+		max     int
+		wclosed bool
+		rclosed bool
+	}
+
+	// mwReader is the read side of an mwPipe.
+	mwReader struct {
+		p *mwPipe
+	}
+
+	// mwCache is the io.Writer of AddWriteThrough, writing through
+	// to w and retaining what w accepted for its readers.
+	mwCache struct {
+		w      io.Writer
+		mu     sync.Mutex
+		cond   sync.Cond
+		data   []byte
+		err    error // of w, returned once data is read
+		closed bool
+	}
+
+	// mwCacheReader reads an mwCache from the start.
+	mwCacheReader struct {
+		c   *mwCache
+		off int
+	}
+
+	// A WriterHealth is a snapshot of the status of one io.Writer
+	// of a MultiWriter, as returned by Health.
+	WriterHealth struct {
+		// ID is the ID of the io.Writer, or -1 for the fallback.
+		ID int
+		// Alive reports whether the io.Writer is still receiving
+		// data, that is, it has not failed.
+		Alive bool
+		// BytesWritten is the number of bytes the io.Writer has
+		// written, not counting records.
+		BytesWritten int64
+		// LastErr is the most recent error of the io.Writer.
+		LastErr error
+		// Backlog is the number of chunks queued for the io.Writer
+		// that it has yet to write.
+		Backlog int
+	}
+
+	// A RecordEncoder encodes records passed to WriteRecord for
+	// one io.Writer of a MultiWriter.  *json.Encoder and
+	// *gob.Encoder are RecordEncoders.
+	RecordEncoder interface {
+		Encode(v interface{}) error
 	}
 )
 
 // NewMultiWriter creates a MultiWriter from the io.Writer(s)
 // specified as args.  This only creates the data structure
-// and does not initialize any goroutines.
+// and does not initialize any goroutines.  The io.Writers are
+// given the IDs 0 through len(ws)-1, in order, for use with
+// RemoveWriter.
 func NewMultiWriter(ws ...io.Writer) *MultiWriter {
 
 	mw := &MultiWriter{
 		WriteChanLength: DefaultWriteChanLength,
-		err:             make(chan error, 1),
 	}
 
 	for _, w := range ws {
-		mw.writers = append(mw.writers, &mwWriter{w: w})
+		mw.writers = append(mw.writers, &mwWriter{id: mw.nextID, w: w})
+		mw.nextID++
 	}
 
 	return mw
 
 }
 
+// AddWriter adds w to the MultiWriter and returns its ID.  w
+// receives only the data written after AddWriter returns.
+// Returns ErrClosed if the MultiWriter is closed.
+func (mw *MultiWriter) AddWriter(w io.Writer) (int, error) {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return 0, ErrClosed
+	}
+
+	if mw.DedupeWriters {
+		if mww := mw.find(w); mww != nil {
+			return mww.id, nil
+		}
+	}
+
+	// coalesced data was written before w was added
+	if err := mw.flush(); err != nil {
+		return 0, err
+	}
+
+	mww := &mwWriter{id: mw.nextID, w: w}
+	mw.nextID++
+	mw.writers = append(mw.writers, mww)
+
+	if mw.inited {
+		mw.start(mww)
+	}
+
+	return mww.id, nil
+
+}
+
+// AddRecordWriter adds w to the MultiWriter as a record writer and
+// returns its ID.  A record writer receives each value passed to
+// WriteRecord, encoded by enc in w's goroutine, rather than the data
+// of Write, so each sink may encode records in its own format.  enc
+// would typically write to w, and w is closed by Close as any
+// io.Writer is.  An error from enc fails the record writer as an
+// error from an io.Writer fails it, affecting no other io.Writer
+// when ContinueOnError is set.  Returns ErrClosed if the MultiWriter
+// is closed.
+func (mw *MultiWriter) AddRecordWriter(w io.Writer, enc RecordEncoder) (int, error) {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return 0, ErrClosed
+	}
+
+	mww := &mwWriter{id: mw.nextID, w: w, enc: enc}
+	mw.nextID++
+	mw.writers = append(mw.writers, mww)
+
+	if mw.inited {
+		mw.start(mww)
+	}
+
+	return mww.id, nil
+
+}
+
+// NewReader returns an io.ReadCloser that receives a copy of all
+// data written to the MultiWriter after it is created, for a
+// consumer that pulls data while the io.Writers have it pushed to
+// them.  Up to maxBuffered bytes are buffered for the reader, or
+// DefaultBufferSize if maxBuffered is less than one.  Once the
+// buffer is full the reader applies backpressure as a slow io.Writer
+// does: its channel fills, then Write blocks unless DropOnFull is
+// set, in which case data is dropped for the reader alone.  The
+// reader must therefore be consumed or closed.  It returns io.EOF
+// once the MultiWriter is closed and the buffered data is read.
+// Closing it discards its data without failing the MultiWriter.
+// Returns ErrClosed if the MultiWriter is closed.
+func (mw *MultiWriter) NewReader(maxBuffered int) (io.ReadCloser, error) {
+
+	if maxBuffered < 1 {
+		maxBuffered = DefaultBufferSize
+	}
+
+	p := &mwPipe{max: maxBuffered}
+	p.cond.L = &p.mu
+
+	if _, err := mw.AddWriter(p); err != nil {
+		return nil, err
+	}
+
+	return mwReader{p: p}, nil
+
+}
+
+// AddWriteThrough adds w to the MultiWriter, as AddWriter does, and
+// returns an io.Reader of the data written to w, for reading back
+// what was written, such as to serve a local cache file as it is
+// filled, without reading the underlying storage.  The io.Reader
+// reads from the first byte written to w, waiting for more at the
+// end of the data until the MultiWriter is closed, when it returns
+// io.EOF, and so reflects both the data written so far and future
+// Writes.  It only returns data that w has accepted, and if w
+// fails, returns the error once the data before it is read.  The
+// data is retained in memory for the io.Reader until the MultiWriter
+// is discarded.  Returns ErrClosed if the MultiWriter is closed.
+func (mw *MultiWriter) AddWriteThrough(w io.Writer) (int, io.Reader, error) {
+
+	c := &mwCache{w: w}
+	c.cond.L = &c.mu
+
+	id, err := mw.AddWriter(c)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return id, &mwCacheReader{c: c}, nil
+
+}
+
+// Writes data to w, retaining what it accepted.
+func (c *mwCache) Write(data []byte) (int, error) {
+
+	n, err := c.w.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+
+	c.mu.Lock()
+	c.data = append(c.data, data[:n]...)
+	if err != nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	return n, err
+
+}
+
+// Close closes w, if it has a `Close() error` method, and marks
+// the end of the data.
+func (c *mwCache) Close() error {
+
+	var err error
+
+	if wc, ok := c.w.(io.WriteCloser); ok {
+		err = wc.Close()
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	return err
+
+}
+
+// Read reads the data retained after that already read, waiting
+// for more if there is none.
+func (r *mwCacheReader) Read(b []byte) (int, error) {
+
+	c := r.c
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for r.off == len(c.data) && c.err == nil && !c.closed {
+		c.cond.Wait()
+	}
+
+	if r.off < len(c.data) {
+		n := copy(b, c.data[r.off:])
+		r.off += n
+		return n, nil
+	}
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return 0, io.EOF
+
+}
+
+// Buffers data for the reader, waiting while the buffer is full.
+// Data is discarded once the reader is closed.
+func (p *mwPipe) Write(data []byte) (int, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(data)
+
+	for len(data) > 0 && !p.rclosed {
+		room := p.max - len(p.buf)
+		if room == 0 {
+			p.cond.Wait()
+			continue
+		}
+		if room > len(data) {
+			room = len(data)
+		}
+		p.buf = append(p.buf, data[:room]...)
+		data = data[room:]
+		p.cond.Broadcast()
+	}
+
+	return n, nil
+
+}
+
+// Close marks the end of the data, called when the MultiWriter
+// is closed.
+func (p *mwPipe) Close() error {
+
+	p.mu.Lock()
+	p.wclosed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	return nil
+
+}
+
+// Read reads the data buffered for the reader, waiting for more
+// if there is none.
+func (r mwReader) Read(b []byte) (int, error) {
+
+	p := r.p
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.buf) == 0 && !p.wclosed && !p.rclosed {
+		p.cond.Wait()
+	}
+
+	if p.rclosed {
+		return 0, ErrClosed
+	}
+	if len(p.buf) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(b, p.buf)
+	p.buf = p.buf[:copy(p.buf, p.buf[n:])]
+	p.cond.Broadcast()
+
+	return n, nil
+
+}
+
+// Close stops the reader receiving data.  Subsequent reads return
+// ErrClosed.
+func (r mwReader) Close() error {
+
+	p := r.p
+
+	p.mu.Lock()
+	p.rclosed = true
+	p.buf = nil
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	return nil
+
+}
+
+// SetTier places the io.Writer with the given ID in tier n.  Writes
+// wait only for the io.Writers of tier 1, the default, to accept
+// their data.  io.Writers of tier 2 and above receive it on a best
+// effort basis, as with DropOnFull: data is dropped for them when
+// their channel is full, so a Write is acknowledged once the fast,
+// local sinks have it while slow, remote ones replicate it in the
+// background.  Consequently a higher tier io.Writer may hold less
+// than a tier 1 io.Writer, with gaps a SequenceWriter can detect.
+// Close still waits for every tier to write the data it accepted,
+// and checkpoints still wait for every tier.  Values of n less than
+// one are treated as one.  Returns ErrUnknownWriter if there is no
+// io.Writer with the ID.
+func (mw *MultiWriter) SetTier(id, n int) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	for _, mww := range mw.writers {
+		if mww.id == id {
+			mww.tier = n
+			return nil
+		}
+	}
+
+	return ErrUnknownWriter
+
+}
+
+// Health returns a snapshot of the status of each io.Writer, in the
+// order they were registered, followed by the fallback if one is
+// set.  It is safe to call concurrently with the other methods,
+// though it waits for any Write blocked on a full channel.
+func (mw *MultiWriter) Health() []WriterHealth {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	writers := mw.writers
+	if mw.fallback != nil {
+		writers = append(writers[:len(writers):len(writers)], mw.fallback)
+	}
+
+	hs := make([]WriterHealth, len(writers))
+
+	mw.errMu.Lock()
+	defer mw.errMu.Unlock()
+
+	for i, mww := range writers {
+		hs[i] = WriterHealth{
+			ID:           mww.id,
+			Alive:        mww.err == nil,
+			BytesWritten: atomic.LoadInt64(&mww.n),
+			Backlog:      len(mww.wc),
+		}
+		if len(mww.errs) > 0 {
+			hs[i].LastErr = mww.errs[len(mww.errs)-1]
+		}
+	}
+
+	return hs
+
+}
+
+// SetCloseChain declares the layers an io.Writer is stacked on, such
+// as the gzip.Writer and *os.File beneath a tar.Writer, which must
+// be closed in order from the outermost for the output to be
+// complete.  layers are given outermost first, each being the
+// io.Writer that the previous one, or the io.Writer with the given
+// ID for the first, writes to.  When the io.Writer is closed, by
+// Close or RemoveWriter, and once it has written all of its data,
+// each layer is then flushed if it has a `Flush() error` method, as
+// a bufio.Writer does, and closed if it has a `Close() error`
+// method, in order, each only after the previous has returned.  The
+// layers are closed even if the io.Writer has failed, and their
+// errors are returned with its errors.  Returns ErrUnknownWriter if
+// there is no io.Writer with the ID.
+func (mw *MultiWriter) SetCloseChain(id int, layers ...io.Writer) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	for _, mww := range mw.writers {
+		if mww.id == id {
+			mww.chain = layers
+			return nil
+		}
+	}
+
+	return ErrUnknownWriter
+
+}
+
+// OnComplete sets fn to be called once the io.Writer with the given
+// ID has written all of its data and been closed, by Close or
+// RemoveWriter, with the number of bytes it wrote and its first
+// error, or nil if it succeeded.  This allows a finalizing step per
+// sink, such as renaming a temporary file or committing a
+// transaction.  fn is called from the io.Writer's goroutine after
+// its close chain, if any, and before Close returns.  It is not
+// called if the MultiWriter is closed without having been written
+// to.  Returns ErrUnknownWriter if there is no io.Writer with the ID.
+func (mw *MultiWriter) OnComplete(id int, fn func(bytesWritten int64, err error)) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	for _, mww := range mw.writers {
+		if mww.id == id {
+			mww.complete = fn
+			return nil
+		}
+	}
+
+	return ErrUnknownWriter
+
+}
+
+// SetFraming makes the io.Writer with the given ID receive each
+// Write as a discrete frame, prefixed with its length in bytes as
+// an unsigned integer of size bytes in the given byte order, for
+// sinks that expect messages rather than a stream, such as a socket
+// protocol.  Each chunk the io.Writer receives is one frame, so a
+// frame boundary is placed at every Write, at every chunk of
+// WriteAll, and, with CoalesceSize, at every coalesced buffer
+// instead.  The prefix and the data are written to the io.Writer
+// together in a single Write, from its goroutine, and are both
+// counted as bytes written.  A chunk too long for the prefix fails
+// the io.Writer with ErrFrameTooLarge.  size may be 2, 4 or 8, and
+// other values are treated as 4.  A nil order is treated as
+// binary.BigEndian.  This must be called before the io.Writer
+// receives any data.  Returns ErrUnknownWriter if there is no
+// io.Writer with the ID.
+func (mw *MultiWriter) SetFraming(id, size int, order binary.ByteOrder) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if size != 2 && size != 8 {
+		size = 4
+	}
+	if order == nil {
+		order = binary.BigEndian
+	}
+
+	for _, mww := range mw.writers {
+		if mww.id == id {
+			mww.frame, mww.order = size, order
+			return nil
+		}
+	}
+
+	return ErrUnknownWriter
+
+}
+
+// SetFallback sets an io.Writer that receives the data of each
+// Write made once every other io.Writer has failed, so that data
+// is not lost when all of them die.  It requires ContinueOnError.
+// The fallback is started when a Write first finds no live
+// io.Writer.  Data already queued for an io.Writer when it fails
+// is dropped rather than diverted, so no data is duplicated but
+// some may be lost at the switchover.  The fallback receives each
+// Write until an io.Writer is added, and is closed by Close like
+// the other io.Writers.  This must be called before the first
+// Write.  Returns ErrClosed if the MultiWriter is closed.
+func (mw *MultiWriter) SetFallback(w io.Writer) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return ErrClosed
+	}
+
+	mw.fallback = &mwWriter{id: -1, w: w}
+
+	return nil
+
+}
+
+// RemoveWriter stops sending data to the io.Writer with the given
+// ID and waits for it to finish writing the data already sent to
+// it, then closes it if it has a `Close() error` method, as Close
+// does.  The other io.Writers are unaffected, and Writes to them
+// continue while it drains.  Together with AddWriter, this allows a
+// sink to be replaced mid-stream.  Returns the io.Writer's errors,
+// which are no longer reported by Close, ErrUnknownWriter if there
+// is no io.Writer with the ID, or ErrClosed if the MultiWriter is
+// closed.
+func (mw *MultiWriter) RemoveWriter(id int) error {
+
+	mww, started, err := mw.detach(id)
+	if err != nil {
+		return err
+	}
+
+	if !started {
+		errs := mww.close()
+		if mww.complete != nil {
+			var err error
+			if len(errs) > 0 {
+				err = errs[0]
+			}
+			mww.complete(0, err)
+		}
+		return joinErrs(errs)
+	}
+
+	// mu is not held, so other writes continue while it drains
+	<-mww.done
+
+	return joinErrs(mww.errs)
+
+}
+
+// Removes the io.Writer with the given ID from the MultiWriter,
+// closing its channel if it was started, and reports whether it was.
+func (mw *MultiWriter) detach(id int) (*mwWriter, bool, error) {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return nil, false, ErrClosed
+	}
+
+	if err := mw.flush(); err != nil {
+		return nil, false, err
+	}
+
+	for i, mww := range mw.writers {
+		if mww.id != id {
+			continue
+		}
+		mw.writers = append(mw.writers[:i], mw.writers[i+1:]...)
+		if mw.inited {
+			close(mww.wc)
+		}
+		return mww, mw.inited, nil
+	}
+
+	return nil, false, ErrUnknownWriter
+
+}
+
 // Handles the initialization of channels and goroutines
 // required for the concurrent distribution of writes.
 func (mw *MultiWriter) init() {
 
 	mw.inited = true
 
+	if mw.DedupeWriters {
+		writers := mw.writers
+		mw.writers = nil
+		for _, mww := range writers {
+			if mw.find(mww.w) == nil {
+				mw.writers = append(mw.writers, mww)
+			}
+		}
+	}
+
+	for _, mww := range mw.writers {
+		mw.start(mww)
+	}
+
+	if mw.CoalesceSize > 0 && mw.FlushInterval > 0 {
+		mw.stop = make(chan struct{})
+		go mw.flushEvery(mw.FlushInterval, mw.stop)
+	}
+
+}
+
+// Flushes the coalesced data every d until stop is closed.  This
+// is not counted in wg, as Close waits on wg while holding mu.
+func (mw *MultiWriter) flushEvery(d time.Duration, stop chan struct{}) {
+
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+		mw.mu.Lock()
+		if !mw.closed {
+			// errors are returned by the next Write
+			mw.flush()
+		}
+		mw.mu.Unlock()
+	}
+
+}
+
+// Returns the mwWriter of w, or nil if w is not one of the
+// MultiWriter's io.Writers or is not comparable.
+func (mw *MultiWriter) find(w io.Writer) *mwWriter {
+
+	if !reflect.TypeOf(w).Comparable() {
+		return nil
+	}
+
 	for _, mww := range mw.writers {
+		if mww.w == w {
+			return mww
+		}
+	}
 
-		mww.wc = make(chan []byte, mw.WriteChanLength)
-		mw.wg.Add(1)
+	return nil
 
-		go func(mww *mwWriter) {
-			defer func() {
-				if wc, ok := mww.w.(io.WriteCloser); ok {
-					if err := wc.Close(); err != nil {
-						mw.err <- err
-					}
-				}
-				mw.wg.Done()
-			}()
-			for data := range mww.wc {
-				if n, err := mww.w.Write(data); err != nil {
-					mw.err <- err
-					return
-				} else if n < len(data) {
-					mw.err <- io.ErrShortWrite
+}
+
+// Starts the goroutine writing mww's data channel to its io.Writer.
+func (mw *MultiWriter) start(mww *mwWriter) {
+
+	mww.wc = make(chan mwChunk, mw.WriteChanLength)
+	mww.done = make(chan struct{})
+	mw.wg.Add(1)
+
+	go func() {
+		defer mw.wg.Done()
+		defer close(mww.done)
+		defer func() {
+			for _, err := range mww.close() {
+				mw.recordErr(mww, err)
+			}
+			if mww.complete != nil {
+				mw.errMu.Lock()
+				err := mww.err
+				mw.errMu.Unlock()
+				mww.complete(atomic.LoadInt64(&mww.n), err)
+			}
+		}()
+		for c := range mww.wc {
+			if c.ack != nil {
+				close(c.ack)
+				continue
+			}
+			if c.record {
+				if err := mww.enc.Encode(c.rec); err != nil {
+					mw.recordErr(mww, err)
 					return
 				}
+				continue
+			}
+			if err := mww.write(c); err != nil {
+				mw.recordErr(mww, err)
+				return
 			}
-		}(mww)
+		}
+	}()
+
+}
+
+// Closes the io.Writer, if it has a `Close() error` method, and
+// then each layer of its close chain in order.  Returns the errors
+// encountered.
+func (mww *mwWriter) close() []error {
+
+	var errs []error
+
+	if wc, ok := mww.w.(io.WriteCloser); ok {
+		if err := wc.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, w := range mww.chain {
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+
+}
+
+// Writes a chunk to the io.Writer.
+func (mww *mwWriter) write(c mwChunk) error {
+
+	var (
+		n    int
+		err  error
+		data = c.data
+	)
+
+	if mww.frame > 0 {
+		if data, err = mww.prefix(data); err != nil {
+			return err
+		}
+	}
+
+	if sw, ok := mww.w.(SequenceWriter); ok {
+		n, err = sw.WriteSequence(c.seq, data)
+	} else {
+		n, err = mww.w.Write(data)
+	}
+
+	atomic.AddInt64(&mww.n, int64(n))
+
+	if err != nil {
+		return err
+	}
+	if n < len(data) {
+		return io.ErrShortWrite
+	}
+
+	return nil
+
+}
+
+// Returns data prefixed with its length, as set by SetFraming,
+// in a buffer reused by the next call.
+func (mww *mwWriter) prefix(data []byte) ([]byte, error) {
+
+	if mww.frame < 8 && uint64(len(data)) >= 1<<(8*uint(mww.frame)) {
+		return nil, ErrFrameTooLarge
+	}
+
+	n := mww.frame + len(data)
+	if cap(mww.framed) < n {
+		mww.framed = make([]byte, n)
+	}
+	buf := mww.framed[:n]
 
+	switch mww.frame {
+	case 2:
+		mww.order.PutUint16(buf, uint16(len(data)))
+	case 4:
+		mww.order.PutUint32(buf, uint32(len(data)))
+	default:
+		mww.order.PutUint64(buf, uint64(len(data)))
 	}
+	copy(buf[mww.frame:], data)
+
+	return buf, nil
 
 }
 
@@ -91,23 +947,356 @@ func (mw *MultiWriter) init() {
 // to be present for the write that it fails on.
 func (mw *MultiWriter) Write(data []byte) (int, error) {
 
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.CoalesceSize > 0 {
+		if mw.closed {
+			return 0, ErrClosed
+		}
+		if !mw.inited {
+			// starts the FlushInterval timer
+			mw.init()
+		}
+		if len(data) < mw.CoalesceSize {
+			if mw.pending == nil {
+				mw.pending = make([]byte, 0, 2*mw.CoalesceSize)
+			}
+			mw.pending = append(mw.pending, data...)
+			if len(mw.pending) >= mw.CoalesceSize {
+				if err := mw.flush(); err != nil {
+					return 0, err
+				}
+			}
+			return len(data), nil
+		}
+		if err := mw.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := mw.write(data); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+
+}
+
+// WriteAll writes each chunk to every io.Writer of the MultiWriter
+// as a single logical unit.  Each io.Writer receives the chunks in
+// order, with no data from any other Write or WriteAll interleaved
+// between them, regardless of how many goroutines are writing.
+// With DropOnFull, an io.Writer receives either all of the chunks
+// or none of them.  If there are more chunks than WriteChanLength,
+// they could never all fit in a channel, so WriteAll instead blocks
+// until each io.Writer, including those of tier 2 and above, has
+// room for them, as if DropOnFull were unset.  WriteAll returns the total number of bytes in
+// chunks and any error, with the same semantics as Write.
+func (mw *MultiWriter) WriteAll(chunks ...[]byte) (int, error) {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if err := mw.flush(); err != nil {
+		return 0, err
+	}
+
+	if err := mw.write(chunks...); err != nil {
+		return 0, err
+	}
+
+	var n int
+
+	for _, data := range chunks {
+		n += len(data)
+	}
+
+	return n, nil
+
+}
+
+// ReadFrom reads from r until EOF and writes the data to each
+// io.Writer of the MultiWriter.  Because the io.Writers consume
+// data asynchronously, each read is made into a newly allocated
+// buffer rather than reusing one, making io.Copy into a MultiWriter
+// safe.  Returns the number of bytes written and any error except
+// io.EOF.
+func (mw *MultiWriter) ReadFrom(r io.Reader) (int64, error) {
+
+	var total int64
+
+	for {
+		buf := make([]byte, DefaultBufferSize)
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := mw.Write(buf[:n]); err != nil {
+				return total, err
+			}
+			total += int64(n)
+		}
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+	}
+
+}
+
+// Sends data to each io.Writer's channel.  Callers must hold mw.mu.
+func (mw *MultiWriter) write(chunks ...[]byte) error {
+
 	if mw.closed {
-		return 0, ErrClosed
+		return ErrClosed
+	}
+
+	if !mw.inited {
+		mw.init()
+	}
+
+	var (
+		one [1]mwChunk
+		cs  = one[:]
+	)
+	if len(chunks) > 1 {
+		cs = make([]mwChunk, len(chunks))
+	}
+	for i, data := range chunks {
+		cs[i] = mwChunk{seq: mw.seq, data: data}
+		mw.seq++
+	}
+
+	return mw.deliver(cs)
+
+}
+
+// WriteRecord sends v to each record writer added by
+// AddRecordWriter, which encodes it with its RecordEncoder.  Other
+// io.Writers do not receive v.  v must not be modified until every
+// record writer has encoded it, as by awaiting a Checkpoint.  A
+// record counts as one Write in sequence numbers.  Returns any error
+// with the same semantics as Write.
+func (mw *MultiWriter) WriteRecord(v interface{}) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return ErrClosed
+	}
+
+	if err := mw.flush(); err != nil {
+		return err
 	}
 
 	if !mw.inited {
 		mw.init()
 	}
 
+	cs := []mwChunk{{seq: mw.seq, rec: v, record: true}}
+	mw.seq++
+
+	return mw.deliver(cs)
+
+}
+
+// Sends cs to each io.Writer that receives its kind of chunk, or
+// to the fallback if none are live.  Callers must hold mw.mu.
+func (mw *MultiWriter) deliver(cs []mwChunk) error {
+
+	var live int
+
 	for _, mww := range mw.writers {
+		if (mww.enc != nil) != cs[0].record {
+			continue
+		}
+		if err := mw.send(mww, cs); err != nil {
+			if mw.ContinueOnError {
+				continue
+			}
+			return err
+		}
+		live++
+	}
+
+	if live == 0 && mw.fallback != nil && !cs[0].record {
+		if mw.fallback.wc == nil {
+			mw.start(mw.fallback)
+		}
+		return mw.send(mw.fallback, cs)
+	}
+
+	return nil
+
+}
+
+// Sends cs to mww.  Returns the error of mww if it has failed.
+func (mw *MultiWriter) send(mww *mwWriter, cs []mwChunk) error {
+
+	if mw.ContinueOnError {
+		// skip a failed io.Writer even if its channel has room
 		select {
-		case mww.wc <- data:
-		case err := <-mw.err:
-			return 0, err
+		case <-mww.done:
+			return mww.err
+		default:
 		}
 	}
 
-	return len(data), nil
+	// only the caller holding mu sends on wc, so room in the
+	// channel cannot shrink while the chunks are sent.  More chunks
+	// than the channel holds could never all fit, so they are sent
+	// blocking rather than always dropped.
+	lossy := (mw.DropOnFull || mww.tier > 1) && (len(cs) == 1 || len(cs) <= cap(mww.wc))
+	if lossy && cap(mww.wc)-len(mww.wc) < len(cs) {
+		select {
+		case <-mww.done:
+			return mww.err
+		default:
+		}
+		if len(cs) == 1 {
+			// an unbuffered channel may still have a receiver
+			select {
+			case mww.wc <- cs[0]:
+			default:
+			}
+		}
+		return nil
+	}
+
+	for _, c := range cs {
+		if mw.OnBackpressure != nil {
+			select {
+			case mww.wc <- c:
+				continue
+			default:
+				mw.OnBackpressure(mww.id)
+			}
+		}
+		select {
+		case mww.wc <- c:
+		case <-mww.done:
+			return mww.err
+		}
+	}
+
+	return nil
+
+}
+
+// Checkpoint sends a barrier named name through each io.Writer's
+// channel, behind all data written so far.  Await(name) blocks until
+// every io.Writer has processed the data up to the barrier.  Any
+// number of checkpoints with distinct names may be in flight at
+// once, and a checkpoint is forgotten once awaited.  Barriers are
+// never dropped, even with DropOnFull.  Returns ErrClosed if the
+// MultiWriter is closed, or ErrCheckpointPending if a checkpoint
+// named name has not yet been awaited.
+func (mw *MultiWriter) Checkpoint(name string) error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return ErrClosed
+	}
+
+	if !mw.inited {
+		mw.init()
+	}
+
+	if err := mw.flush(); err != nil {
+		return err
+	}
+
+	if mw.checkpoints == nil {
+		mw.checkpoints = make(map[string][]mwBarrier)
+	}
+
+	if _, ok := mw.checkpoints[name]; ok {
+		return ErrCheckpointPending
+	}
+
+	barriers := make([]mwBarrier, len(mw.writers))
+	mw.checkpoints[name] = barriers
+
+	for i, mww := range mw.writers {
+		barriers[i] = mwBarrier{mww: mww, ack: make(chan struct{})}
+		select {
+		case mww.wc <- mwChunk{ack: barriers[i].ack}:
+		case <-mww.done:
+		}
+	}
+
+	return nil
+
+}
+
+// Await blocks until every io.Writer has processed all data written
+// before Checkpoint(name) was called.  It returns the error of each
+// io.Writer, in the order they were registered, that failed before
+// reaching the checkpoint, with nil for those that reached it.
+// Only the io.Writers present when Checkpoint was called are
+// included.  Returns nil if there is no pending checkpoint named
+// name.
+func (mw *MultiWriter) Await(name string) []error {
+
+	mw.mu.Lock()
+	barriers, ok := mw.checkpoints[name]
+	delete(mw.checkpoints, name)
+	mw.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	errs := make([]error, len(barriers))
+
+	for i, b := range barriers {
+		select {
+		case <-b.ack:
+			continue
+		default:
+		}
+		select {
+		case <-b.ack:
+		case <-b.mww.done:
+			errs[i] = b.mww.err
+		}
+	}
+
+	return errs
+
+}
+
+// Flush sends any data accumulated by CoalesceSize to the
+// io.Writers.  It does not wait for them to write it.
+func (mw *MultiWriter) Flush() error {
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return ErrClosed
+	}
+
+	return mw.flush()
+
+}
+
+// Sends the data accumulated by CoalesceSize, if any.  The caller
+// must hold mu.
+func (mw *MultiWriter) flush() error {
+
+	if len(mw.pending) == 0 {
+		return nil
+	}
+
+	data := mw.pending
+	mw.pending = nil
+
+	return mw.write(data)
 
 }
 
@@ -116,22 +1305,80 @@ func (mw *MultiWriter) Write(data []byte) (int, error) {
 // checked for a `Close() error` method.  If the method is
 // found it is called.  This method blocks until all io.Writers
 // have completed consuming their data channels, and optionally
-// closed.  The first error encountered is returned, or nil if none.
+// closed.  The error encountered is returned, or nil if none.  If
+// several io.Writers failed, their errors are combined.
+// Subsequent calls return ErrClosed.
 func (mw *MultiWriter) Close() error {
 
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.closed {
+		return ErrClosed
+	}
+
+	// errors from failed io.Writers are collected below
+	mw.flush()
+
 	mw.closed = true
 
+	if mw.stop != nil {
+		close(mw.stop)
+	}
+
 	if mw.inited {
-		for _, mww := range mw.writers {
+		writers := mw.writers
+		if mw.fallback != nil {
+			// started, if unused, so it is closed like the others
+			if mw.fallback.wc == nil {
+				mw.start(mw.fallback)
+			}
+			writers = append(writers[:len(writers):len(writers)], mw.fallback)
+		}
+
+		for _, mww := range writers {
 			close(mww.wc)
 		}
 
 		mw.wg.Wait()
-		close(mw.err)
 
-		return <-mw.err
+		var errs []error
+		for _, mww := range writers {
+			errs = append(errs, mww.errs...)
+		}
+
+		return joinErrs(errs)
 	}
 
 	return nil
 
 }
+
+// Returns nil for no errors, the error itself for one, or the
+// errors combined.
+func joinErrs(errs []error) error {
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errors.Join(errs...)
+	}
+
+}
+
+// Records an error from mww.  The first error is retained by mww
+// and returned by any Write blocked on it.
+func (mw *MultiWriter) recordErr(mww *mwWriter, err error) {
+
+	mw.errMu.Lock()
+	defer mw.errMu.Unlock()
+
+	if mww.err == nil {
+		mww.err = err
+	}
+	mww.errs = append(mww.errs, err)
+
+}
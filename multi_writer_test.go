@@ -1,11 +1,21 @@
 package extio
 
 import (
+	"archive/tar"
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
 	"testing"
+	"time"
 )
 
 type (
@@ -21,6 +31,14 @@ type (
 	testShortWriter struct {
 		bytes.Buffer
 	}
+	testSlowWriter struct {
+		bytes.Buffer
+	}
+	testSequenceWriter struct {
+		delay time.Duration
+		seqs  []uint64
+	}
+	testChanWriter chan []byte
 )
 
 var (
@@ -33,6 +51,23 @@ func (_ *testErrorWriteCloser) Close() error           { return closeErr }
 func (_ *testErrorWriter) Write(_ []byte) (int, error) { return 0, writeErr }
 func (_ *testShortWriter) Write(b []byte) (int, error) { return len(b) - 1, nil }
 
+func (w *testSequenceWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *testSequenceWriter) WriteSequence(seq uint64, b []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.seqs = append(w.seqs, seq)
+	return len(b), nil
+}
+
+func (w testChanWriter) Write(b []byte) (int, error) {
+	w <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (w *testSlowWriter) Write(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return w.Buffer.Write(b)
+}
+
 func TestMultiWriterOne(t *testing.T) {
 
 	buf := &testOKWriteCloser{}
@@ -95,6 +130,295 @@ func TestMultiWriterErrors(t *testing.T) {
 
 }
 
+func TestMultiWriterHealth(t *testing.T) {
+
+	var ok bytes.Buffer
+
+	mw := NewMultiWriter(&ok, &testErrorWriter{})
+	mw.ContinueOnError = true
+
+	for i := 0; i < 3; i++ {
+		if _, err := mw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mw.Checkpoint("written")
+	mw.Await("written")
+
+	hs := mw.Health()
+	if len(hs) != 2 {
+		t.Fatalf("Expected 2 writers, got %d", len(hs))
+	}
+	if h := hs[0]; h.ID != 0 || !h.Alive || h.LastErr != nil || h.BytesWritten != int64(3*len(data)) || h.Backlog != 0 {
+		t.Errorf("Expected a healthy writer with %d bytes written, got %+v", 3*len(data), h)
+	}
+	if h := hs[1]; h.ID != 1 || h.Alive || h.LastErr != writeErr || h.BytesWritten != 0 {
+		t.Errorf("Expected a failed writer, got %+v", h)
+	}
+
+	mw.Close()
+
+}
+
+func TestMultiWriterMultipleErrors(t *testing.T) {
+
+	mw := NewMultiWriter(
+		&testErrorWriter{},
+		&testErrorWriter{},
+		&testErrorWriteCloser{},
+		&testErrorWriteCloser{},
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 3; i++ {
+			mw.Write(data)
+		}
+		done <- mw.Close()
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, writeErr) || !errors.Is(err, closeErr) {
+			t.Errorf("Expected %q and %q, got %q", writeErr, closeErr, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocked on multiple failing writers")
+	}
+
+}
+
+func TestMultiWriterReadFrom(t *testing.T) {
+
+	testdata := make([]byte, 1<<20)
+	rand.Read(testdata)
+
+	fast, slow := &bytes.Buffer{}, &testSlowWriter{}
+	mw := NewMultiWriter(fast, slow)
+
+	// hide WriteTo so io.Copy uses ReadFrom
+	n, err := io.Copy(mw, struct{ io.Reader }{bytes.NewReader(testdata)})
+	if err != nil {
+		t.Error(err)
+	}
+	if n != int64(len(testdata)) {
+		t.Errorf("Short write!  expected %d, got %d", len(testdata), n)
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(fast.Bytes(), testdata) {
+		t.Error("data mismatch on fast writer")
+	}
+	if !bytes.Equal(slow.Bytes(), testdata) {
+		t.Error("data mismatch on slow writer")
+	}
+
+}
+
+func TestMultiWriterNested(t *testing.T) {
+
+	var (
+		leaves = []*testOKWriteCloser{
+			&testOKWriteCloser{},
+			&testOKWriteCloser{},
+			&testOKWriteCloser{},
+		}
+		inner = NewMultiWriter(leaves[1], leaves[2])
+
+		pr, pw       = io.Pipe()
+		broadcast    = NewBroadcaster(pr)
+		broadcastOut = &bytes.Buffer{}
+
+		outer = NewMultiWriter(leaves[0], inner, pw)
+	)
+
+	broadcast.NewReaderToWriter(broadcastOut)
+	done := make(chan error, 1)
+	go func() { done <- broadcast.Broadcast() }()
+
+	for i := 0; i < 10; i++ {
+		if _, err := outer.Write(data); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := outer.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// every level has drained and closed once the root is closed
+	expected := bytes.Repeat(data, 10)
+	for i, leaf := range leaves {
+		if !bytes.Equal(leaf.Bytes(), expected) {
+			t.Errorf("%d leaf data mismatch", i)
+		}
+	}
+	if err := inner.Close(); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(broadcastOut.Bytes(), expected) {
+		t.Error("broadcast data mismatch")
+	}
+
+}
+
+func TestMultiWriterSequence(t *testing.T) {
+
+	const writes = 100
+
+	// lossless delivery yields a continuous sequence
+	sw := &testSequenceWriter{}
+	mw := NewMultiWriter(sw)
+	for i := 0; i < writes; i++ {
+		mw.Write(data)
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+	if len(sw.seqs) != writes {
+		t.Fatalf("Expected %d chunks, got %d", writes, len(sw.seqs))
+	}
+	for i, seq := range sw.seqs {
+		if seq != uint64(i) {
+			t.Fatalf("Expected sequence %d, got %d", i, seq)
+		}
+	}
+
+	// a slow writer dropping chunks detects the gaps
+	sw = &testSequenceWriter{delay: time.Millisecond}
+	mw = NewMultiWriter(sw)
+	mw.WriteChanLength = 1
+	mw.DropOnFull = true
+	for i := 0; i < writes; i++ {
+		if i == writes-1 {
+			time.Sleep(20 * time.Millisecond) // let the final chunk through
+		}
+		if _, err := mw.Write(data); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	var gaps uint64
+	for i, seq := range sw.seqs {
+		if i > 0 {
+			if seq <= sw.seqs[i-1] {
+				t.Fatalf("Sequence not increasing: %d after %d", seq, sw.seqs[i-1])
+			}
+			gaps += seq - sw.seqs[i-1] - 1
+		} else {
+			gaps += seq
+		}
+	}
+	if gaps+uint64(len(sw.seqs)) != writes {
+		t.Errorf("Expected %d gaps, got %d", writes-len(sw.seqs), gaps)
+	}
+	if gaps == 0 {
+		t.Error("Expected dropped chunks to be detected")
+	}
+	// chunks of a WriteAll are dropped together
+	sw = &testSequenceWriter{delay: time.Millisecond}
+	mw = NewMultiWriter(sw)
+	mw.WriteChanLength = 3
+	mw.DropOnFull = true
+	for i := 0; i < writes; i++ {
+		if _, err := mw.WriteAll(data[:1], data[1:]); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+	if len(sw.seqs) == 2*writes {
+		t.Error("Expected dropped chunks")
+	}
+	for i := 0; i < len(sw.seqs); i += 2 {
+		if sw.seqs[i]%2 != 0 || i+1 == len(sw.seqs) || sw.seqs[i+1] != sw.seqs[i]+1 {
+			t.Fatalf("WriteAll partially delivered: %v", sw.seqs)
+		}
+	}
+
+	// chunks of a WriteAll that exceed the channel are never dropped
+	sw = &testSequenceWriter{delay: time.Millisecond}
+	mw = NewMultiWriter(sw)
+	mw.WriteChanLength = 1
+	mw.DropOnFull = true
+	for i := 0; i < 10; i++ {
+		if _, err := mw.WriteAll(data[:1], data[1:2], data[2:]); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+	if len(sw.seqs) != 30 {
+		t.Errorf("Expected 30 chunks, got %d", len(sw.seqs))
+	}
+
+}
+
+func TestMultiWriterCheckpoint(t *testing.T) {
+
+	var (
+		fast = &bytes.Buffer{}
+		slow = &testSlowWriter{}
+		mw   = NewMultiWriter(fast, slow, struct{ io.Writer }{&testErrorWriter{}})
+	)
+
+	mw.Write(data)
+	if err := mw.Checkpoint("first"); err != nil {
+		t.Error(err)
+	}
+	mw.Write(data)
+	mw.Write(data)
+	if err := mw.Checkpoint("second"); err != nil {
+		t.Error(err)
+	}
+	if err := mw.Checkpoint("first"); err != ErrCheckpointPending {
+		t.Errorf("Expected %q, got %q", ErrCheckpointPending, err)
+	}
+
+	// await out of order
+	errs := mw.Await("second")
+	if fast.Len() != 3*len(data) || slow.Len() != 3*len(data) {
+		t.Errorf("Expected %d bytes at second checkpoint, got %d and %d", 3*len(data), fast.Len(), slow.Len())
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] != writeErr {
+		t.Errorf("Expected [nil nil %q], got %q", writeErr, errs)
+	}
+
+	errs = mw.Await("first")
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] != writeErr {
+		t.Errorf("Expected [nil nil %q], got %q", writeErr, errs)
+	}
+
+	if errs := mw.Await("first"); errs != nil {
+		t.Errorf("Expected nil for awaited checkpoint, got %q", errs)
+	}
+
+	// names may be reused once awaited
+	if err := mw.Checkpoint("first"); err != nil {
+		t.Error(err)
+	}
+	mw.Await("first")
+
+	mw.Close()
+
+	if err := mw.Checkpoint("closed"); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+}
+
 func TestMultiWriterRange(t *testing.T) {
 
 	for i := 0; i < 30; i++ {
@@ -131,6 +455,790 @@ func TestMultiWriterRange(t *testing.T) {
 
 }
 
+func TestMultiWriterWriteAll(t *testing.T) {
+
+	const (
+		writers = 8
+		frames  = 200
+	)
+
+	bufs := []*bytes.Buffer{&bytes.Buffer{}, &bytes.Buffer{}}
+	mw := NewMultiWriter(bufs[0], bufs[1])
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			header := []byte(fmt.Sprintf("%d:", i))
+			payload := append(bytes.Repeat([]byte{'a' + byte(i)}, 16), '\n')
+			for j := 0; j < frames; j++ {
+				n, err := mw.WriteAll(header, payload)
+				if err != nil {
+					t.Error(err)
+				}
+				if n != len(header)+len(payload) {
+					t.Errorf("Short write!  expected %d, got %d", len(header)+len(payload), n)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	for _, buf := range bufs {
+		var lines int
+		sc := bufio.NewScanner(buf)
+		for sc.Scan() {
+			var (
+				i       int
+				payload string
+			)
+			if _, err := fmt.Sscanf(sc.Text(), "%d:%s", &i, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if expected := string(bytes.Repeat([]byte{'a' + byte(i)}, 16)); payload != expected {
+				t.Errorf("Interleaved frame, expected %q, got %q", expected, payload)
+			}
+			lines++
+		}
+		if lines != writers*frames {
+			t.Errorf("Expected %d frames, got %d", writers*frames, lines)
+		}
+	}
+
+}
+
+func TestMultiWriterSetCloseChain(t *testing.T) {
+
+	var (
+		buf bytes.Buffer
+		gz  = gzip.NewWriter(&buf)
+		bw  = bufio.NewWriter(gz)
+		tw  = tar.NewWriter(bw)
+	)
+
+	if err := tw.WriteHeader(&tar.Header{Name: "data", Mode: 0644, Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+
+	mw := NewMultiWriter(tw)
+	if err := mw.SetCloseChain(0, bw, gz); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.SetCloseChain(1, gz); err != ErrUnknownWriter {
+		t.Errorf("Expected %q, got %q", ErrUnknownWriter, err)
+	}
+
+	if _, err := mw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	if _, err := tr.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(tr); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of data, got %d", len(data), len(got))
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("Expected %q, got %q", io.EOF, err)
+	}
+
+}
+
+func TestMultiWriterSetFraming(t *testing.T) {
+
+	var raw, framed, small bytes.Buffer
+
+	mw := NewMultiWriter(&raw, &framed, &small)
+	mw.ContinueOnError = true
+	if err := mw.SetFraming(1, 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.SetFraming(2, 2, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.SetFraming(3, 4, nil); err != ErrUnknownWriter {
+		t.Errorf("Expected %q, got %q", ErrUnknownWriter, err)
+	}
+
+	var writes [][]byte
+	for _, n := range []int{1, 0, 100, 1 << 10, 7} {
+		p := make([]byte, n)
+		rand.Read(p)
+		writes = append(writes, p)
+		if _, err := mw.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// too large for the prefix of small alone
+	big := make([]byte, 1<<16)
+	writes = append(writes, big)
+	mw.Write(big)
+
+	if err := mw.Close(); err != ErrFrameTooLarge {
+		t.Errorf("Expected %q, got %q", ErrFrameTooLarge, err)
+	}
+
+	if !bytes.Equal(raw.Bytes(), bytes.Join(writes, nil)) {
+		t.Error("raw data mismatch")
+	}
+
+	decode := func(buf *bytes.Buffer, size int, order binary.ByteOrder) [][]byte {
+		var frames [][]byte
+		for buf.Len() > 0 {
+			var n int
+			if size == 2 {
+				n = int(order.Uint16(buf.Next(2)))
+			} else {
+				n = int(order.Uint32(buf.Next(4)))
+			}
+			frames = append(frames, append([]byte{}, buf.Next(n)...))
+		}
+		return frames
+	}
+
+	for _, test := range []struct {
+		name   string
+		frames [][]byte
+		want   [][]byte
+	}{
+		{"framed", decode(&framed, 4, binary.BigEndian), writes},
+		{"small", decode(&small, 2, binary.LittleEndian), writes[:len(writes)-1]},
+	} {
+		if len(test.frames) != len(test.want) {
+			t.Errorf("%s: Expected %d frames, got %d", test.name, len(test.want), len(test.frames))
+			continue
+		}
+		for i, f := range test.frames {
+			if !bytes.Equal(f, test.want[i]) {
+				t.Errorf("%s: frame %d mismatch", test.name, i)
+			}
+		}
+	}
+
+}
+
+func TestMultiWriterOnComplete(t *testing.T) {
+
+	type completion struct {
+		n   int64
+		err error
+	}
+
+	var (
+		ok   bytes.Buffer
+		done = make(chan completion, 2)
+	)
+
+	mw := NewMultiWriter(&ok, &testErrorWriter{})
+	mw.ContinueOnError = true
+	for id := 0; id < 2; id++ {
+		if err := mw.OnComplete(id, func(n int64, err error) {
+			done <- completion{n, err}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.OnComplete(2, func(int64, error) {}); err != ErrUnknownWriter {
+		t.Errorf("Expected %q, got %q", ErrUnknownWriter, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		mw.Write(data)
+	}
+	mw.Close()
+
+	// both have completed by the time Close returns
+	if len(done) != 2 {
+		t.Fatalf("Expected 2 completions, got %d", len(done))
+	}
+	for i := 0; i < 2; i++ {
+		switch c := <-done; c.err {
+		case nil:
+			if c.n != int64(3*len(data)) {
+				t.Errorf("Expected %d bytes written, got %d", 3*len(data), c.n)
+			}
+		case writeErr:
+			if c.n != 0 {
+				t.Errorf("Expected 0 bytes written, got %d", c.n)
+			}
+		default:
+			t.Errorf("Unexpected error %v", c.err)
+		}
+	}
+
+}
+
+func TestMultiWriterRemoveWriter(t *testing.T) {
+
+	var (
+		outputs = []*bytes.Buffer{
+			&bytes.Buffer{},
+			&bytes.Buffer{},
+		}
+		first  = &testOKWriteCloser{}
+		second = &testSlowWriter{}
+		mw     = NewMultiWriter(outputs[0], outputs[1], first)
+		half   = len(data) / 2
+	)
+
+	if _, err := mw.Write(data[:half]); err != nil {
+		t.Error(err)
+	}
+
+	// rotate the third sink mid-stream
+	if err := mw.RemoveWriter(2); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(first.Bytes(), data[:half]) {
+		t.Errorf("Expected %d bytes in removed writer, got %d", half, first.Len())
+	}
+	id, err := mw.AddWriter(second)
+	if err != nil {
+		t.Error(err)
+	}
+	if id != 3 {
+		t.Errorf("Expected id %d, got %d", 3, id)
+	}
+
+	if _, err := mw.Write(data[half:]); err != nil {
+		t.Error(err)
+	}
+
+	if err := mw.RemoveWriter(2); err != ErrUnknownWriter {
+		t.Errorf("Expected %q, got %q", ErrUnknownWriter, err)
+	}
+
+	// a failed writer's error is reported by RemoveWriter, not Close
+	id, _ = mw.AddWriter(&testErrorWriteCloser{})
+	mw.Write(data)
+	if err := mw.RemoveWriter(id); err != closeErr {
+		t.Errorf("Expected %q, got %q", closeErr, err)
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), append(append([]byte(nil), data...), data...)) {
+			t.Errorf("%d writer data mismatch", i)
+		}
+	}
+	if !bytes.Equal(second.Bytes(), append(append([]byte(nil), data[half:]...), data...)) {
+		t.Error("data mismatch in added writer")
+	}
+
+	if _, err := mw.AddWriter(ioutil.Discard); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+	// writes continue while a removed sink drains
+	var (
+		out     bytes.Buffer
+		blocked = make(testChanWriter)
+		removed = make(chan error)
+	)
+	mw = NewMultiWriter(&out, blocked)
+	mw.Write(data)
+	go func() { removed <- mw.RemoveWriter(1) }()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := mw.Write(data); err != nil {
+		t.Error(err)
+	}
+	if err := mw.Flush(); err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-removed:
+		t.Errorf("Expected RemoveWriter to wait for the sink, got %v", err)
+	default:
+	}
+	if b := <-blocked; !bytes.Equal(b, data) {
+		t.Error("data mismatch in removed writer")
+	}
+	if err := <-removed; err != nil {
+		t.Error(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(out.Bytes(), append(append([]byte(nil), data...), data...)) {
+		t.Error("data mismatch in remaining writer")
+	}
+
+}
+
+func TestMultiWriterFallback(t *testing.T) {
+
+	var (
+		primary  = &bytes.Buffer{}
+		fallback = &testOKWriteCloser{}
+		mw       = NewMultiWriter(primary, &testErrorWriter{}, &testErrorWriter{})
+	)
+	mw.ContinueOnError = true
+	if err := mw.SetFallback(fallback); err != nil {
+		t.Error(err)
+	}
+
+	// failed writers are skipped while any remain
+	for i := 0; i < 3; i++ {
+		if _, err := mw.Write(data); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Checkpoint("failed"); err != nil {
+		t.Error(err)
+	}
+	if errs := mw.Await("failed"); errs[0] != nil || errs[1] != writeErr || errs[2] != writeErr {
+		t.Errorf("Expected [nil %q %q], got %q", writeErr, writeErr, errs)
+	}
+	if fallback.Len() != 0 {
+		t.Errorf("Expected unused fallback, got %d bytes", fallback.Len())
+	}
+
+	// no live writers remain
+	if err := mw.RemoveWriter(0); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := mw.Write(data); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := mw.Close(); !errors.Is(err, writeErr) {
+		t.Errorf("Expected %q, got %q", writeErr, err)
+	}
+	if !bytes.Equal(fallback.Bytes(), bytes.Repeat(data, 3)) {
+		t.Errorf("Expected %d bytes in fallback, got %d", 3*len(data), fallback.Len())
+	}
+
+}
+
+func TestMultiWriterCoalesce(t *testing.T) {
+
+	var (
+		outputs = []*bytes.Buffer{
+			&bytes.Buffer{},
+			&bytes.Buffer{},
+		}
+		sw = &testSequenceWriter{}
+		mw = NewMultiWriter(outputs[0], outputs[1], sw)
+	)
+	mw.CoalesceSize = 1 << 10
+
+	for i := 0; i < len(data); i += 50 {
+		end := i + 50
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := mw.Write(data[i:end]); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := mw.Checkpoint("written"); err != nil {
+		t.Error(err)
+	}
+	mw.Await("written")
+
+	if want := (len(data) + mw.CoalesceSize - 1) / mw.CoalesceSize; len(sw.seqs) > want+1 {
+		t.Errorf("Expected about %d coalesced writes, got %d", want, len(sw.seqs))
+	}
+
+	mw.Write([]byte("tail"))
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	for i, out := range outputs {
+		if !bytes.Equal(out.Bytes(), append(append([]byte(nil), data...), "tail"...)) {
+			t.Errorf("%d writer data mismatch", i)
+		}
+	}
+
+	if _, err := mw.Write([]byte("x")); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+}
+
+func TestMultiWriterDedupeWriters(t *testing.T) {
+
+	var (
+		out = &bytes.Buffer{}
+		mw  = NewMultiWriter(out, out, ioutil.Discard)
+	)
+	mw.DedupeWriters = true
+
+	if _, err := mw.Write([]byte("one")); err != nil {
+		t.Error(err)
+	}
+
+	id, err := mw.AddWriter(out)
+	if err != nil {
+		t.Error(err)
+	}
+	if id != 0 {
+		t.Errorf("Expected existing ID 0, got %d", id)
+	}
+
+	if _, err := mw.Write([]byte("two")); err != nil {
+		t.Error(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if out.String() != "onetwo" {
+		t.Errorf("Expected %q, got %q", "onetwo", out.String())
+	}
+
+}
+
+func TestMultiWriterWriteRecord(t *testing.T) {
+
+	type record struct {
+		Name  string
+		Count int
+	}
+
+	var (
+		raw      = &bytes.Buffer{}
+		jsonOut  = &bytes.Buffer{}
+		gobOut   = &bytes.Buffer{}
+		mw       = NewMultiWriter(raw)
+		expected = []record{{"one", 1}, {"two", 2}}
+	)
+
+	if _, err := mw.AddRecordWriter(jsonOut, json.NewEncoder(jsonOut)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mw.AddRecordWriter(gobOut, gob.NewEncoder(gobOut)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mw.Write([]byte("bytes")); err != nil {
+		t.Error(err)
+	}
+	for _, r := range expected {
+		if err := mw.WriteRecord(r); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if raw.String() != "bytes" {
+		t.Errorf("Expected %q, got %q", "bytes", raw.String())
+	}
+
+	var (
+		jd = json.NewDecoder(jsonOut)
+		gd = gob.NewDecoder(gobOut)
+	)
+	for _, want := range expected {
+		var jr, gr record
+		if err := jd.Decode(&jr); err != nil {
+			t.Error(err)
+		}
+		if err := gd.Decode(&gr); err != nil {
+			t.Error(err)
+		}
+		if jr != want || gr != want {
+			t.Errorf("Expected %v, got %v and %v", want, jr, gr)
+		}
+	}
+
+	// an encoder error fails only its writer
+	mw = NewMultiWriter()
+	mw.ContinueOnError = true
+	mw.AddRecordWriter(ioutil.Discard, json.NewEncoder(ioutil.Discard))
+	if err := mw.WriteRecord(make(chan int)); err != nil {
+		t.Error(err)
+	}
+	if err := mw.Close(); err == nil {
+		t.Error("Expected encoder error from Close")
+	}
+
+}
+
+func TestMultiWriterOnBackpressure(t *testing.T) {
+
+	var (
+		events = make(map[int]int)
+		mw     = NewMultiWriter(ioutil.Discard, &testSlowWriter{})
+	)
+	mw.WriteChanLength = 1
+	mw.OnBackpressure = func(id int) {
+		events[id]++
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, err := mw.Write([]byte("x")); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if events[1] == 0 {
+		t.Error("Expected backpressure from the slow writer")
+	}
+	if events[0] > events[1] {
+		t.Errorf("Expected the slow writer to block most, got %v", events)
+	}
+
+}
+
+func TestMultiWriterNewReader(t *testing.T) {
+
+	var (
+		out = &bytes.Buffer{}
+		mw  = NewMultiWriter(out)
+	)
+
+	r, err := mw.NewReader(1 << 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []byte)
+	go func() {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- b
+	}()
+
+	for i := 0; i < len(data); i += 100 {
+		end := i + 100
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := mw.Write(data[i:end]); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(<-done, data) {
+		t.Error("reader data mismatch")
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("writer data mismatch")
+	}
+
+	// a closed reader does not stall the writers
+	mw = NewMultiWriter(ioutil.Discard)
+	mw.WriteChanLength = 1
+	r, _ = mw.NewReader(16)
+	r.Close()
+	for i := 0; i < 100; i++ {
+		if _, err := mw.Write(data[:64]); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+	if _, err := mw.NewReader(0); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+
+}
+
+func TestMultiWriterAddWriteThrough(t *testing.T) {
+
+	var sink bytes.Buffer
+
+	mw := NewMultiWriter(ioutil.Discard)
+	mw.Write(data[:100]) // before the cache is added
+
+	_, r, err := mw.AddWriteThrough(&sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []byte, 1)
+	go func() {
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- got
+	}()
+
+	for rest := data[100:]; len(rest) > 0; {
+		n := 1000
+		if n > len(rest) {
+			n = len(rest)
+		}
+		if _, err := mw.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-done
+	if !bytes.Equal(got, data[100:]) {
+		t.Errorf("Expected %d bytes read back, got %d", len(data)-100, len(got))
+	}
+	if !bytes.Equal(sink.Bytes(), got) {
+		t.Errorf("Expected the sink to hold the %d bytes read back, got %d", len(got), sink.Len())
+	}
+
+	// the data written is read back after the fact too
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Expected %q, got %d bytes and %v", io.EOF, n, err)
+	}
+
+	// data a failed sink accepted is read back before its error
+	mw = NewMultiWriter()
+	_, r, _ = mw.AddWriteThrough(&testShortWriter{})
+	mw.Write([]byte("data"))
+	mw.Close()
+	if got, err := ioutil.ReadAll(r); err != io.ErrShortWrite || string(got) != "dat" {
+		t.Errorf("Expected %q and %q, got %q and %v", "dat", io.ErrShortWrite, got, err)
+	}
+
+}
+
+func TestMultiWriterSetTier(t *testing.T) {
+
+	var (
+		fast = &bytes.Buffer{}
+		slow = &testSequenceWriter{delay: 10 * time.Millisecond}
+		mw   = NewMultiWriter(fast, slow)
+	)
+	mw.WriteChanLength = 1
+
+	if err := mw.SetTier(1, 2); err != nil {
+		t.Error(err)
+	}
+	if err := mw.SetTier(5, 2); err != ErrUnknownWriter {
+		t.Errorf("Expected %q, got %q", ErrUnknownWriter, err)
+	}
+
+	// writes are not held back by the slow tier 2 writer
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if _, err := mw.Write([]byte("x")); err != nil {
+			t.Error(err)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Expected writes to track the fast writer, took %s", d)
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if fast.Len() != 20 {
+		t.Errorf("Expected 20 bytes written to tier 1, got %d", fast.Len())
+	}
+	if len(slow.seqs) == 0 || len(slow.seqs) == 20 {
+		t.Errorf("Expected tier 2 to receive some writes, got %d", len(slow.seqs))
+	}
+
+}
+
+func TestMultiWriterFlushInterval(t *testing.T) {
+
+	var (
+		w  = make(testChanWriter, 8)
+		mw = NewMultiWriter(w)
+	)
+	mw.CoalesceSize = 1 << 10
+	mw.FlushInterval = 20 * time.Millisecond
+
+	for _, line := range []string{"one\n", "two\n"} {
+		start := time.Now()
+		if _, err := mw.Write([]byte(line)); err != nil {
+			t.Error(err)
+		}
+		select {
+		case b := <-w:
+			if string(b) != line {
+				t.Errorf("Expected %q, got %q", line, b)
+			}
+			if d := time.Since(start); d > 10*mw.FlushInterval {
+				t.Errorf("Expected flush within %s, took %s", mw.FlushInterval, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected coalesced data to be flushed")
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// the timer has stopped
+	time.Sleep(2 * mw.FlushInterval)
+	if len(w) != 0 {
+		t.Errorf("Expected no writes after Close, got %d", len(w))
+	}
+
+}
+
+func BenchmarkMultiWriterSmallWrites(b *testing.B) {
+	runBenchmarkMultiWriterSmallWrites(0, b)
+}
+
+func BenchmarkMultiWriterSmallWritesCoalesced(b *testing.B) {
+	runBenchmarkMultiWriterSmallWrites(32<<10, b)
+}
+
+func runBenchmarkMultiWriterSmallWrites(coalesceSize int, b *testing.B) {
+
+	line := make([]byte, 50)
+
+	mw := NewMultiWriter(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+	mw.CoalesceSize = coalesceSize
+
+	b.SetBytes(int64(len(line)))
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mw.Write(line)
+	}
+
+	mw.Close()
+
+}
+
 func BenchmarkMultiWriter(b *testing.B) {
 
 	mw := NewMultiWriter(ioutil.Discard)
@@ -0,0 +1,146 @@
+package extio
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+type (
+	// A ReaderAdapter wraps an io.Reader in another io.Reader that
+	// imposes its own framing on the data, such as aligning reads
+	// or bounding them by a delimiter.  Adapters let each consumer
+	// of a Broadcaster read with its own granularity without
+	// affecting the shared reads from the source.  Any function
+	// with this signature may be used as an adapter.
+	ReaderAdapter func(r io.Reader) io.Reader
+
+	// splitReader returns at most one token from its split func
+	// per Read.
+	splitReader struct {
+		r       io.Reader
+		split   bufio.SplitFunc
+		scratch []byte
+		buf     []byte
+		token   []byte
+		err     error
+	}
+
+	adaptedReader struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// Adapt returns an io.ReadCloser that reads from the
+// BroadcasterReader through each adapter in order, the
+// first adapter wrapping the BroadcasterReader itself.
+// Closing it closes the BroadcasterReader.
+func (br *BroadcasterReader) Adapt(adapters ...ReaderAdapter) io.ReadCloser {
+
+	var r io.Reader = br
+
+	for _, adapter := range adapters {
+		r = adapter(r)
+	}
+
+	return &adaptedReader{Reader: r, Closer: br}
+
+}
+
+// SplitAdapter returns a ReaderAdapter whose reads each return
+// data from at most one token identified by split.  A token larger
+// than the buffer passed to Read is returned over successive reads,
+// but a single Read never spans two tokens.
+func SplitAdapter(split bufio.SplitFunc) ReaderAdapter {
+	return func(r io.Reader) io.Reader {
+		return &splitReader{
+			r:       r,
+			split:   split,
+			scratch: make([]byte, DefaultBufferSize),
+		}
+	}
+}
+
+// DelimiterAdapter returns a ReaderAdapter whose reads each return
+// data up to and including delim.  The final read before io.EOF
+// may not end in delim.
+func DelimiterAdapter(delim byte) ReaderAdapter {
+	return SplitAdapter(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i+1], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+}
+
+// RecordAdapter returns a ReaderAdapter whose reads each return
+// a single record of size bytes.  The final read before io.EOF
+// may be a partial record.
+func RecordAdapter(size int) ReaderAdapter {
+	return SplitAdapter(func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) >= size {
+			return size, data[:size], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+}
+
+// AlignAdapter returns a ReaderAdapter whose reads each return a
+// multiple of size bytes, provided the buffer passed to Read is
+// itself a multiple of size.  The final read before io.EOF may be
+// unaligned.
+func AlignAdapter(size int) ReaderAdapter {
+	return SplitAdapter(func(data []byte, atEOF bool) (int, []byte, error) {
+		if n := len(data) - len(data)%size; n > 0 {
+			return n, data[:n], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+}
+
+// Read copies the next token, or what remains of it, into b.
+func (sr *splitReader) Read(b []byte) (int, error) {
+
+	for len(sr.token) == 0 {
+
+		if len(sr.buf) > 0 || sr.err != nil {
+			adv, token, err := sr.split(sr.buf, sr.err != nil)
+			if err != nil {
+				sr.err = err
+				return 0, err
+			}
+			sr.buf = sr.buf[adv:]
+			if len(token) > 0 {
+				sr.token = token
+				break
+			}
+			if adv > 0 {
+				continue
+			}
+			if sr.err != nil {
+				return 0, sr.err
+			}
+		}
+
+		n, err := sr.r.Read(sr.scratch)
+		sr.buf = append(sr.buf, sr.scratch[:n]...)
+		sr.err = err
+
+	}
+
+	n := copy(b, sr.token)
+	sr.token = sr.token[n:]
+
+	return n, nil
+
+}
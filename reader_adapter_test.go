@@ -0,0 +1,113 @@
+package extio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestReaderAdapterDelimiter(t *testing.T) {
+
+	b := NewBroadcaster(bytes.NewReader(data))
+	b.ReadBufferSize = 100
+
+	var (
+		lines []string
+		raw   []byte
+		wg    sync.WaitGroup
+	)
+
+	lr := b.NewReader().Adapt(DelimiterAdapter('\n'))
+	rr := b.NewReader()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer lr.Close()
+		buf := make([]byte, 1<<10)
+		for {
+			n, err := lr.Read(buf)
+			if n > 0 {
+				lines = append(lines, string(buf[:n]))
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		if raw, err = ioutil.ReadAll(rr); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := b.Broadcast(); err != nil {
+		t.Error(err)
+	}
+
+	wg.Wait()
+
+	expected := bytes.SplitAfter(data, []byte("\n"))
+	if len(expected[len(expected)-1]) == 0 {
+		expected = expected[:len(expected)-1]
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i, line := range lines {
+		if line != string(expected[i]) {
+			t.Errorf("Expected %q, got %q", expected[i], line)
+		}
+	}
+
+	if !bytes.Equal(raw, data) {
+		t.Error("data mismatch on unadapted reader")
+	}
+
+}
+
+func TestReaderAdapterRecordAlign(t *testing.T) {
+
+	buf := make([]byte, 64)
+
+	r := RecordAdapter(10)(bytes.NewReader(data))
+	var out []byte
+	for {
+		n, err := r.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if n != 10 && len(out)+n != len(data) {
+			t.Errorf("Expected record of %d bytes, got %d", 10, n)
+		}
+		out = append(out, buf[:n]...)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("data mismatch on record reader")
+	}
+
+	r = AlignAdapter(16)(bytes.NewReader(data))
+	out = out[:0]
+	for {
+		n, err := r.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if n%16 != 0 && len(out)+n != len(data) {
+			t.Errorf("Expected multiple of %d bytes, got %d", 16, n)
+		}
+		out = append(out, buf[:n]...)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("data mismatch on aligned reader")
+	}
+
+}
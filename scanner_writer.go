@@ -2,21 +2,108 @@ package extio
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type (
 	// ScannerWriter satisfies the io.WriteCloser interface and
 	// turns a series of writes into a stream of tokens that can
-	// be processed by a callback.
+	// be processed by a callback.  A ScannerWriter is not
+	// reentrant: calling Write, Flush or Close from within
+	// the tokenFunc returns ErrReentrant.
 	ScannerWriter struct {
 		buf        []byte
 		maxBufSize int
 
 		closed bool
+		active bool
 
 		splitFunc bufio.SplitFunc
 		tokenFunc func(token []byte) error
+
+		// scan, if set, replaces splitFunc in Write with a
+		// specialized implementation that scans in place
+		scan func(sc *ScannerWriter, data []byte) ([]byte, error)
+
+		// BufferPool, if set, supplies the *[]byte buffers that hold
+		// data awaiting a token boundary, allowing buffer management
+		// to be shared across many ScannerWriters.  Buffers are
+		// borrowed when data must be retained between Writes and
+		// returned once it has been consumed.  Tokens passed to
+		// tokenFunc may reside in a borrowed buffer and are only
+		// valid until tokenFunc returns.  When nil, buffers are
+		// allocated as needed.  A New func, if any, must return a
+		// *[]byte. (default: nil)
+		BufferPool *sync.Pool
+
+		// MaxProcessTime, if greater than zero, bounds the time a
+		// single Write spends passing tokens to tokenFunc.  Once
+		// exceeded, Write stops after the current token, retains the
+		// unprocessed data in the buffer and returns successfully,
+		// letting latency sensitive callers yield.  The remaining
+		// tokens are passed to tokenFunc by subsequent Writes, or by
+		// Flush or Close. (default: 0)
+		MaxProcessTime time.Duration
+
+		// OnBuffered, if set, is called after a Write that passed
+		// no token to tokenFunc but left data buffered, with the
+		// number of bytes buffered.  This lets callers feeding input
+		// that has yet to complete a token notice it approaching
+		// maxBufSize before Write returns io.ErrShortBuffer.  It is
+		// called before Write returns, so calling the ScannerWriter's
+		// methods from it returns ErrReentrant. (default: nil)
+		OnBuffered func(pending int)
+
+		// HighWaterMark, if greater than zero, is an absolute limit
+		// on the bytes the ScannerWriter retains between Writes.
+		// maxBufSize limits a single unterminated token, but the
+		// buffer may exceed it, such as when MaxProcessTime defers
+		// complete tokens.  A Write that would leave more than
+		// HighWaterMark bytes buffered discards the buffer and
+		// returns ErrBufferLimit, bounding the memory an untrusted
+		// stream can consume. (default: 0)
+		HighWaterMark int
+
+		deadline time.Time
+		emitted  bool // a token was passed to tokenFunc by Write
+
+		// hdrs holds *[]byte taken from BufferPool for reuse when
+		// returning buffers, so that Put does not allocate
+		hdrs []*[]byte
+
+		// onClose, if set, is called by Close after the final
+		// tokens are passed to tokenFunc
+		onClose func() error
+	}
+
+	// orderedPool processes tokens concurrently for an ordered
+	// ScannerWriter and commits the results in token order.
+	orderedPool struct {
+		workers int
+		process func(token []byte) (interface{}, error)
+		commit  func(result interface{}) error
+
+		jobs    chan orderedJob
+		results chan orderedJob
+		slots   chan struct{} // bounds the tokens in flight
+		done    chan struct{} // closed once every result is committed
+		seq     uint64
+
+		mu  sync.Mutex
+		err error
+	}
+
+	// orderedJob is a token being processed by an orderedPool,
+	// and then its result.
+	orderedJob struct {
+		seq    uint64
+		token  []byte
+		result interface{}
+		err    error
 	}
 )
 
@@ -36,20 +123,283 @@ func NewScannerWriter(splitFunc bufio.SplitFunc, maxBufSize int, tokenFunc func(
 	}
 }
 
+// NewStatefulScannerWriter creates a new ScannerWriter, as
+// NewScannerWriter does, whose split function is passed state
+// along with the data, for split functions whose behavior depends
+// on what they have already seen, such as a parser that switches
+// modes after a keyword token.  split may update state, which
+// tokenFunc may also read, so the state of the stream is kept with
+// the ScannerWriter rather than in a closure.  state lives as long
+// as the ScannerWriter, which has no Reset, so each stream should
+// have its own ScannerWriter and state.  If state is nil, a new
+// zero S is used.
+func NewStatefulScannerWriter[S any](state *S, split func(state *S, data []byte, atEOF bool) (advance int, token []byte, err error), maxBufSize int, tokenFunc func([]byte) error) *ScannerWriter {
+
+	if state == nil {
+		state = new(S)
+	}
+
+	return NewScannerWriter(func(data []byte, atEOF bool) (int, []byte, error) {
+		return split(state, data, atEOF)
+	}, maxBufSize, tokenFunc)
+
+}
+
+// NewLineScannerWriter creates a new ScannerWriter that splits
+// lines exactly as bufio.ScanLines does, using a specialized scanner
+// that avoids the allocations of the general splitFunc path.  Tokens
+// passed to tokenFunc are only valid until tokenFunc returns.  The
+// ScannerWriter retains a single buffer and does not use BufferPool.
+func NewLineScannerWriter(maxBufSize int, tokenFunc func([]byte) error) *ScannerWriter {
+	sc := NewScannerWriter(bufio.ScanLines, maxBufSize, tokenFunc)
+	sc.scan = (*ScannerWriter).scanLines
+	return sc
+}
+
+// NewWordScannerWriter creates a new ScannerWriter that splits
+// words exactly as bufio.ScanWords does, using a specialized scanner
+// that avoids the allocations of the general splitFunc path.  Tokens
+// passed to tokenFunc are only valid until tokenFunc returns.  The
+// ScannerWriter retains a single buffer and does not use BufferPool.
+func NewWordScannerWriter(maxBufSize int, tokenFunc func([]byte) error) *ScannerWriter {
+	sc := NewScannerWriter(bufio.ScanWords, maxBufSize, tokenFunc)
+	sc.scan = (*ScannerWriter).scanWords
+	return sc
+}
+
+// NewOrderedScannerWriter creates a new ScannerWriter that passes
+// each token identified by splitFunc to process in one of workers
+// goroutines, so that tokens are processed concurrently and out of
+// order, and then passes each result to commit from a single
+// goroutine in the order of the tokens, such as to write parsed
+// records to an ordered sink.  Results that complete ahead of an
+// earlier token are held in a reorder buffer until it commits.  At
+// most 2 * workers tokens are in flight, so the reorder buffer holds
+// at most that many results, and Write blocks once the limit is
+// reached until the earliest token commits.  Tokens are copied for
+// process, which may retain them.  The first error from process or
+// commit, in token order, stops further commits and is returned by
+// the next Write and by Close, which waits for every token to be
+// processed and committed.  Values of workers less than one are
+// treated as one.
+func NewOrderedScannerWriter(splitFunc bufio.SplitFunc, maxBufSize, workers int, process func(token []byte) (interface{}, error), commit func(result interface{}) error) *ScannerWriter {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &orderedPool{
+		workers: workers,
+		process: process,
+		commit:  commit,
+	}
+
+	sc := NewScannerWriter(splitFunc, maxBufSize, p.submit)
+	sc.onClose = p.close
+
+	return sc
+
+}
+
+// Sends a copy of token to the workers, starting them with the
+// first token.  Returns the first error of processing or committing
+// an earlier token.
+func (p *orderedPool) submit(token []byte) error {
+
+	if p.jobs == nil {
+		p.start()
+	}
+
+	if err := p.failed(); err != nil {
+		return err
+	}
+
+	p.slots <- struct{}{}
+	p.jobs <- orderedJob{seq: p.seq, token: append([]byte(nil), token...)}
+	p.seq++
+
+	return nil
+
+}
+
+// Starts the workers and the committer.
+func (p *orderedPool) start() {
+
+	p.jobs = make(chan orderedJob, p.workers)
+	p.results = make(chan orderedJob, p.workers)
+	p.slots = make(chan struct{}, 2*p.workers)
+	p.done = make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range p.jobs {
+				j.result, j.err = p.process(j.token)
+				j.token = nil
+				p.results <- j
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(p.results)
+	}()
+
+	go p.commitInOrder()
+
+}
+
+// Commits the results in token order, holding those that complete
+// early until the tokens before them have committed.
+func (p *orderedPool) commitInOrder() {
+
+	defer close(p.done)
+
+	var (
+		pending = make(map[uint64]orderedJob)
+		next    uint64
+	)
+
+	for j := range p.results {
+		pending[j.seq] = j
+		for {
+			j, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if j.err == nil && p.failed() == nil {
+				j.err = p.commit(j.result)
+			}
+			if j.err != nil {
+				p.fail(j.err)
+			}
+			<-p.slots
+		}
+	}
+
+}
+
+// Returns the first error of processing or committing a token.
+func (p *orderedPool) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Records err if it is the first.
+func (p *orderedPool) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Waits for every token submitted to be committed.
+func (p *orderedPool) close() error {
+
+	if p.jobs == nil {
+		return nil
+	}
+
+	close(p.jobs)
+	<-p.done
+
+	return p.failed()
+
+}
+
+// NewJoinScannerWriter creates a new ScannerWriter that writes
+// each token identified by splitFunc to dst, separated by sep, so
+// that the ScannerWriter reformats a stream, such as collapsing
+// runs of whitespace with bufio.ScanWords and a single space.  sep
+// is written between tokens, never before the first or after the
+// last.  An error writing to dst is returned by Write.
+func NewJoinScannerWriter(splitFunc bufio.SplitFunc, maxBufSize int, dst io.Writer, sep []byte) *ScannerWriter {
+
+	var started bool
+
+	return NewScannerWriter(splitFunc, maxBufSize, func(token []byte) error {
+		if started {
+			if _, err := dst.Write(sep); err != nil {
+				return err
+			}
+		}
+		started = true
+		_, err := dst.Write(token)
+		return err
+	})
+
+}
+
 // Write writes the contents of data to the buffer and immediately
 // parses the buffer for as many tokens as splitFunc identifies.
 // Any remaining data is left in the buffer until the next Write
 // or Flush.  Returns number of bytes written and any error.
 func (sc *ScannerWriter) Write(data []byte) (int, error) {
 
+	if sc.active {
+		return 0, ErrReentrant
+	}
+	sc.active = true
+	defer func() { sc.active = false }()
+
 	if sc.closed {
 		return 0, ErrClosed
 	}
 
+	if sc.MaxProcessTime > 0 {
+		sc.deadline = time.Now().Add(sc.MaxProcessTime)
+		defer func() { sc.deadline = time.Time{} }()
+	}
+
+	if sc.OnBuffered != nil {
+		sc.emitted = false
+		defer func() {
+			if !sc.emitted && len(sc.buf) > 0 {
+				sc.OnBuffered(len(sc.buf))
+			}
+		}()
+	}
+
+	n, err := sc.write(data)
+	if err == nil && sc.HighWaterMark > 0 && len(sc.buf) > sc.HighWaterMark {
+		buf := sc.buf
+		sc.buf = nil
+		sc.free(buf)
+		return 0, ErrBufferLimit
+	}
+
+	return n, err
+
+}
+
+// Scans data with the specialized scanner or splitFunc.
+func (sc *ScannerWriter) write(data []byte) (int, error) {
+
+	if sc.scan != nil {
+		return sc.writeScan(data)
+	}
+
 	dataLen := len(data)
 
+	// work is the pooled buffer backing data, if any
+	var work []byte
+
 	if sc.buf != nil {
-		data = append(sc.buf, data...)
+		if sc.BufferPool != nil {
+			work = sc.grow(sc.buf, len(data))
+			data = append(work, data...)
+			work = data
+		} else {
+			data = append(sc.buf, data...)
+		}
 		sc.buf = nil
 	}
 
@@ -57,18 +407,21 @@ func (sc *ScannerWriter) Write(data []byte) (int, error) {
 
 		adv, token, err := sc.splitFunc(data, false)
 		if err != nil {
+			sc.free(work)
 			return 0, err
 		}
 
 		if token == nil {
 			if adv == 0 {
 				if len(sc.buf)+len(data) > sc.maxBufSize {
+					sc.free(work)
 					return 0, io.ErrShortBuffer
 				}
-				sc.buf = append(sc.buf, data...)
+				sc.retain(work, data)
 				return dataLen, nil
 			}
-		} else if err := sc.tokenFunc(token); err != nil {
+		} else if err := sc.emit(token); err != nil {
+			sc.free(work)
 			return 0, err
 		}
 
@@ -76,16 +429,274 @@ func (sc *ScannerWriter) Write(data []byte) (int, error) {
 			data = data[adv:]
 		}
 
+		if len(data) > 0 && sc.expired() {
+			sc.retain(work, data)
+			return dataLen, nil
+		}
+
+	}
+
+	sc.free(work)
+
+	return dataLen, nil
+
+}
+
+// Write for the specialized scanners.  Data is scanned in place,
+// and only joined with the retained buffer when it holds the start
+// of a token.
+func (sc *ScannerWriter) writeScan(data []byte) (int, error) {
+
+	dataLen := len(data)
+
+	joined := len(sc.buf) > 0
+	if joined {
+		sc.buf = append(sc.buf, data...)
+		data = sc.buf
+	}
+
+	rest, err := sc.scan(sc, data)
+	if err != nil {
+		sc.buf = sc.buf[:0]
+		return 0, err
+	}
+
+	// rest may hold complete tokens deferred by MaxProcessTime
+	if len(rest) > sc.maxBufSize && !sc.expired() {
+		sc.buf = sc.buf[:0]
+		return 0, io.ErrShortBuffer
+	}
+
+	if joined {
+		sc.buf = sc.buf[:copy(sc.buf, rest)]
+	} else {
+		sc.buf = append(sc.buf[:0], rest...)
 	}
 
 	return dataLen, nil
 
 }
 
+// Passes each line in data to tokenFunc as bufio.ScanLines
+// would split it, and returns the incomplete remainder.
+func (sc *ScannerWriter) scanLines(data []byte) ([]byte, error) {
+
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return data, nil
+		}
+		token := data[:i]
+		if len(token) > 0 && token[len(token)-1] == '\r' {
+			token = token[:len(token)-1]
+		}
+		if err := sc.emit(token); err != nil {
+			return nil, err
+		}
+		data = data[i+1:]
+		if sc.expired() {
+			return data, nil
+		}
+	}
+
+}
+
+// Passes each word in data to tokenFunc as bufio.ScanWords
+// would split it, and returns the incomplete remainder.
+func (sc *ScannerWriter) scanWords(data []byte) ([]byte, error) {
+
+	for {
+		// skip leading spaces
+		i := 0
+		for i < len(data) {
+			r, width := rune(data[i]), 1
+			if r >= utf8.RuneSelf {
+				r, width = utf8.DecodeRune(data[i:])
+			}
+			if !isSpace(r) {
+				break
+			}
+			i += width
+		}
+		data = data[i:]
+		// find the end of the word
+		i = 0
+		for i < len(data) {
+			if c := data[i]; c < utf8.RuneSelf {
+				if asciiSpace[c] {
+					break
+				}
+				i++
+				continue
+			}
+			if r, width := utf8.DecodeRune(data[i:]); !isSpace(r) {
+				i += width
+				continue
+			}
+			break
+		}
+		if i == len(data) {
+			return data, nil
+		}
+		if err := sc.emit(data[:i]); err != nil {
+			return nil, err
+		}
+		_, width := utf8.DecodeRune(data[i:])
+		data = data[i+width:]
+		if sc.expired() {
+			return data, nil
+		}
+	}
+
+}
+
+// Passes token to tokenFunc, noting that Write emitted a token.
+func (sc *ScannerWriter) emit(token []byte) error {
+	sc.emitted = true
+	return sc.tokenFunc(token)
+}
+
+// asciiSpace reports whether an ASCII byte is a space.
+var asciiSpace = [utf8.RuneSelf]bool{'\t': true, '\n': true, '\v': true, '\f': true, '\r': true, ' ': true}
+
+// Reports whether r is a space as defined by bufio.ScanWords.
+func isSpace(r rune) bool {
+	if r <= '\u00FF' {
+		switch r {
+		case ' ', '\t', '\n', '\v', '\f', '\r', '\u0085', '\u00A0':
+			return true
+		}
+		return false
+	}
+	if '\u2000' <= r && r <= '\u200a' {
+		return true
+	}
+	switch r {
+	case '\u1680', '\u2028', '\u2029', '\u202f', '\u205f', '\u3000':
+		return true
+	}
+	return false
+}
+
+// Retains data, the unprocessed remainder of a Write, in the
+// buffer.  work is the pooled buffer backing data, if any.
+func (sc *ScannerWriter) retain(work, data []byte) {
+	if work != nil {
+		sc.buf = work[:copy(work, data)]
+	} else if sc.BufferPool != nil {
+		sc.buf = append(sc.grow(nil, len(data)), data...)
+	} else {
+		sc.buf = append(sc.buf, data...)
+	}
+}
+
+// Reports whether the current Write has exceeded MaxProcessTime.
+func (sc *ScannerWriter) expired() bool {
+	return !sc.deadline.IsZero() && time.Now().After(sc.deadline)
+}
+
+// Returns a buffer from the BufferPool holding the contents of buf
+// with room for at least n more bytes.  buf is returned to the pool
+// if it is replaced.
+func (sc *ScannerWriter) grow(buf []byte, n int) []byte {
+
+	if cap(buf)-len(buf) >= n {
+		return buf
+	}
+
+	var nbuf []byte
+	if p, _ := sc.BufferPool.Get().(*[]byte); p != nil {
+		nbuf, *p = *p, nil
+		sc.hdrs = append(sc.hdrs, p)
+	}
+	if cap(nbuf) < len(buf)+n {
+		nbuf = make([]byte, 0, len(buf)+n)
+	}
+	nbuf = append(nbuf[:0], buf...)
+
+	sc.free(buf)
+
+	return nbuf
+
+}
+
+// Returns buf to the BufferPool, if any.
+func (sc *ScannerWriter) free(buf []byte) {
+	if sc.BufferPool != nil && buf != nil {
+		var p *[]byte
+		if l := len(sc.hdrs); l > 0 {
+			p = sc.hdrs[l-1]
+			sc.hdrs = sc.hdrs[:l-1]
+		} else {
+			p = new([]byte)
+		}
+		*p = buf[:0]
+		sc.BufferPool.Put(p)
+	}
+}
+
 // Flush fluses the contents of the buffer to the splitFunc
 // signalling EOF.
 func (sc *ScannerWriter) Flush() error {
 
+	if sc.active {
+		return ErrReentrant
+	}
+	sc.active = true
+	defer func() { sc.active = false }()
+
+	if sc.closed {
+		return ErrClosed
+	}
+
+	return sc.flush()
+
+}
+
+// SignalEOF marks the end of the current stream, passing the
+// buffer to splitFunc at EOF as Flush does so that any final token
+// reaches tokenFunc, and leaves the ScannerWriter open so that a
+// new stream may be written to it.  Unlike Flush, which retains the
+// buffer if splitFunc fails so that a later Flush or Close may try
+// again, SignalEOF always empties the buffer, so no data of the
+// ended stream is joined with the next.  Unlike Close, subsequent
+// Writes are accepted.
+func (sc *ScannerWriter) SignalEOF() error {
+
+	if sc.active {
+		return ErrReentrant
+	}
+	sc.active = true
+	defer func() { sc.active = false }()
+
+	if sc.closed {
+		return ErrClosed
+	}
+
+	err := sc.flush()
+	if buf := sc.buf; buf != nil {
+		sc.buf = nil
+		sc.free(buf)
+	}
+
+	return err
+
+}
+
+// EmitBuffered passes whatever data is buffered directly to
+// tokenFunc as a single token and clears the buffer.  Unlike Flush,
+// splitFunc is not consulted, so the token is exactly the buffered
+// bytes regardless of any split boundary.  This suits protocols
+// with out of band signals to deliver partial data immediately.
+// tokenFunc is not called if nothing is buffered.
+func (sc *ScannerWriter) EmitBuffered() error {
+
+	if sc.active {
+		return ErrReentrant
+	}
+	sc.active = true
+	defer func() { sc.active = false }()
+
 	if sc.closed {
 		return ErrClosed
 	}
@@ -94,37 +705,112 @@ func (sc *ScannerWriter) Flush() error {
 		return nil
 	}
 
-	_, token, err := sc.splitFunc(sc.buf, true)
-	if err != nil {
-		return err
+	buf := sc.buf
+	sc.buf = nil
+	defer sc.free(buf)
+
+	return sc.tokenFunc(buf)
+
+}
+
+// Passes the buffer to splitFunc at EOF and the resulting tokens,
+// if any, to tokenFunc.
+func (sc *ScannerWriter) flush() error {
+
+	if len(sc.buf) == 0 {
+		return nil
 	}
 
+	buf := sc.buf
 	sc.buf = nil
 
-	if len(token) > 0 {
-		if err := sc.tokenFunc(token); err != nil {
+	// the buffer holds several tokens if MaxProcessTime deferred them
+	for data := buf; len(data) > 0; {
+		adv, token, err := sc.splitFunc(data, true)
+		if err != nil {
+			// retained for a subsequent Flush or Close
+			sc.buf = buf[:copy(buf, data)]
 			return err
 		}
+		if len(token) > 0 {
+			if err := sc.tokenFunc(token); err != nil {
+				sc.free(buf)
+				return err
+			}
+		}
+		if adv == 0 {
+			break
+		}
+		data = data[adv:]
 	}
 
+	sc.free(buf)
+
 	return nil
 
 }
 
+// SetMaxBufSize changes how far into the byte stream subsequent
+// Writes read without finding a token before returning
+// io.ErrShortBuffer, allowing the limit to be raised mid-stream
+// rather than recreating the ScannerWriter.  If n is lowered below
+// Buffered(), the next Write returns io.ErrShortBuffer unless it
+// completes the buffered token.
+func (sc *ScannerWriter) SetMaxBufSize(n int) {
+	sc.maxBufSize = n
+}
+
+// Buffered returns the number of bytes buffered awaiting
+// a token boundary.
+func (sc *ScannerWriter) Buffered() int {
+	return len(sc.buf)
+}
+
+// PendingBytes returns a copy of the bytes buffered awaiting
+// a token boundary.  This is useful for diagnosing input that
+// never completes a token.
+func (sc *ScannerWriter) PendingBytes() []byte {
+	return append([]byte(nil), sc.buf...)
+}
+
 // Close closes the ScannerWriter after calling Flush().
-// Any subsequent writes will return ErrClosed.
+// Any subsequent writes will return ErrClosed.  A ScannerWriter
+// from NewOrderedScannerWriter is closed, and its goroutines
+// stopped, even if the flush fails, whose error is then returned
+// along with any from the final commits.
 func (sc *ScannerWriter) Close() error {
 
+	if sc.active {
+		return ErrReentrant
+	}
+	sc.active = true
+	defer func() { sc.active = false }()
+
 	if sc.closed {
 		return ErrClosed
 	}
 
-	if err := sc.Flush(); err != nil {
+	err := sc.flush()
+
+	if sc.onClose == nil {
+		if err == nil {
+			sc.closed = true
+		}
 		return err
 	}
 
+	// the goroutines behind onClose are stopped even if the
+	// flush failed, which leaves nothing to retry
 	sc.closed = true
 
-	return nil
+	errs := make([]error, 0, 2)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if cerr := sc.onClose(); cerr != nil && cerr != err {
+		errs = append(errs, cerr)
+	}
+
+	return joinErrs(errs)
 
 }
@@ -7,72 +7,140 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"runtime"
 	"sync"
 	"testing"
+	"time"
 )
 
 // tests ScannerWriter parity with bufio.Scanner
 func TestScannerWriter(t *testing.T) {
 
-	for _, splitFunc := range []bufio.SplitFunc{
-		bufio.ScanLines,
-		bufio.ScanWords,
-		bufio.ScanRunes,
-		bufio.ScanBytes,
-	} {
+	for _, pool := range []*sync.Pool{nil, &sync.Pool{}} {
+
+		for _, splitFunc := range []bufio.SplitFunc{
+			bufio.ScanLines,
+			bufio.ScanWords,
+			bufio.ScanRunes,
+			bufio.ScanBytes,
+		} {
 
-		sc := bufio.NewScanner(bytes.NewReader(data))
-		sc.Split(splitFunc)
+			sc := bufio.NewScanner(bytes.NewReader(data))
+			sc.Split(splitFunc)
 
-		var prev []byte
+			var prev []byte
 
-		w := NewScannerWriter(splitFunc, 1<<10, func(token []byte) error {
-			if sc.Scan() {
-				if !bytes.Equal(sc.Bytes(), token) {
-					return fmt.Errorf("After %q Expected: %q, got %q", prev, sc.Bytes(), token)
+			w := NewScannerWriter(splitFunc, 1<<10, func(token []byte) error {
+				if sc.Scan() {
+					if !bytes.Equal(sc.Bytes(), token) {
+						return fmt.Errorf("After %q Expected: %q, got %q", prev, sc.Bytes(), token)
+					}
+					prev = sc.Bytes()
+				}
+				if sc.Err() != nil {
+					return sc.Err()
+				}
+				return nil
+			})
+			w.BufferPool = pool
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				data := []byte(data)
+				for len(data) > 100 {
+					n := rand.Intn(len(data))
+					if _, err := w.Write(data[:n]); err != nil {
+						t.Error(err)
+					}
+					data = data[n:]
+				}
+				if n, err := w.Write(data); err != nil {
+					t.Error(err)
+				} else if n != len(data) {
+					t.Errorf("Expected %d bytes written, got %d", len(data), n)
+				}
+				if err := w.Flush(); err != nil {
+					t.Error(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Error(err)
+				}
+				n, err := w.Write(data)
+				if n != 0 {
+					t.Errorf("Expected 0 bytes on Write after close, got %d\n", n)
+				}
+				if err != ErrClosed {
+					t.Errorf("Expected %q, got %q", ErrClosed, err)
+				}
+			}()
+
+			wg.Wait()
+
+			if pool != nil {
+				if v := pool.Get(); v != nil {
+					if _, ok := v.(*[]byte); !ok {
+						t.Errorf("Expected *[]byte in pool, got %T", v)
+					}
 				}
-				prev = sc.Bytes()
-			}
-			if sc.Err() != nil {
-				return sc.Err()
 			}
-			return nil
-		})
 
-		var wg sync.WaitGroup
-		wg.Add(1)
+		}
+
+	}
+
+}
+
+// tests the specialized ScannerWriters' parity with bufio.Scanner
+func TestScannerWriterSpecialized(t *testing.T) {
+
+	for _, test := range []struct {
+		splitFunc bufio.SplitFunc
+		create    func(int, func([]byte) error) *ScannerWriter
+	}{
+		{bufio.ScanLines, NewLineScannerWriter},
+		{bufio.ScanWords, NewWordScannerWriter},
+	} {
+
+		// include \r\n endings and multi-byte spaces to split across writes
+		input := append(bytes.Replace(data, []byte("\n"), []byte("\r\n"), 5), "\u3000tail\u2003end"...)
+
+		var expected []string
+		sc := bufio.NewScanner(bytes.NewReader(input))
+		sc.Split(test.splitFunc)
+		for sc.Scan() {
+			expected = append(expected, sc.Text())
+		}
+
+		for i := 0; i < 50; i++ {
 
-		go func() {
-			defer wg.Done()
-			data := []byte(data)
-			for len(data) > 100 {
-				n := rand.Intn(len(data))
+			var tokens []string
+			w := test.create(1<<10, func(token []byte) error {
+				tokens = append(tokens, string(token))
+				return nil
+			})
+
+			for data := input; len(data) > 0; {
+				n := rand.Intn(len(data)) + 1
+				if n > 40 {
+					n = 1 + n%40
+				}
 				if _, err := w.Write(data[:n]); err != nil {
-					t.Error(err)
+					t.Fatal(err)
 				}
 				data = data[n:]
 			}
-			if n, err := w.Write(data); err != nil {
-				t.Error(err)
-			} else if n != len(data) {
-				t.Errorf("Expected %d bytes written, got %d", len(data), n)
-			}
-			if err := w.Flush(); err != nil {
-				t.Error(err)
-			}
 			if err := w.Close(); err != nil {
 				t.Error(err)
 			}
-			n, err := w.Write(data)
-			if n != 0 {
-				t.Errorf("Expected 0 bytes on Write after close, got %d\n", n)
-			}
-			if err != ErrClosed {
-				t.Errorf("Expected %q, got %q", ErrClosed, err)
+
+			if fmt.Sprintf("%q", tokens) != fmt.Sprintf("%q", expected) {
+				t.Fatalf("Expected %q, got %q", expected, tokens)
 			}
-		}()
 
-		wg.Wait()
+		}
 
 	}
 
@@ -188,30 +256,618 @@ func TestScannerWriterErrors(t *testing.T) {
 
 }
 
+func TestScannerWriterPendingBytes(t *testing.T) {
+
+	w := NewScannerWriter(bufio.ScanLines, 1<<10, func(_ []byte) error { return nil })
+
+	if _, err := w.Write([]byte("complete\npart")); err != nil {
+		t.Error(err)
+	}
+	if _, err := w.Write([]byte("ial")); err != nil {
+		t.Error(err)
+	}
+
+	pending := w.PendingBytes()
+	if string(pending) != "partial" {
+		t.Errorf("Expected %q, got %q", "partial", pending)
+	}
+	if w.Buffered() != len(pending) {
+		t.Errorf("Expected %d bytes buffered, got %d", len(pending), w.Buffered())
+	}
+
+	// must be a copy
+	pending[0] = 'X'
+	if string(w.PendingBytes()) != "partial" {
+		t.Error("PendingBytes exposed internal buffer")
+	}
+
+}
+
+func TestScannerWriterSetMaxBufSize(t *testing.T) {
+
+	for _, newWriter := range []func(int, func([]byte) error) *ScannerWriter{
+		func(max int, tokenFunc func([]byte) error) *ScannerWriter {
+			return NewScannerWriter(bufio.ScanLines, max, tokenFunc)
+		},
+		NewLineScannerWriter,
+	} {
+
+		var tokens []string
+
+		w := newWriter(8, func(token []byte) error {
+			tokens = append(tokens, string(token))
+			return nil
+		})
+
+		if _, err := w.Write([]byte("0123456789abcdef")); err != io.ErrShortBuffer {
+			t.Errorf("Expected %q, got %q", io.ErrShortBuffer, err)
+		}
+
+		w.SetMaxBufSize(32)
+
+		if _, err := w.Write([]byte("0123456789abcdef")); err != nil {
+			t.Error(err)
+		}
+		if _, err := w.Write([]byte("\n")); err != nil {
+			t.Error(err)
+		}
+		if len(tokens) != 1 || tokens[0] != "0123456789abcdef" {
+			t.Errorf("Expected [%q], got %q", "0123456789abcdef", tokens)
+		}
+
+	}
+
+}
+
+func TestScannerWriterEmitBuffered(t *testing.T) {
+
+	for _, newWriter := range []func(int, func([]byte) error) *ScannerWriter{
+		func(max int, tokenFunc func([]byte) error) *ScannerWriter {
+			return NewScannerWriter(bufio.ScanLines, max, tokenFunc)
+		},
+		NewLineScannerWriter,
+	} {
+
+		var tokens []string
+
+		w := newWriter(1<<10, func(token []byte) error {
+			tokens = append(tokens, string(token))
+			return nil
+		})
+
+		if _, err := w.Write([]byte("line\npartial \r")); err != nil {
+			t.Error(err)
+		}
+		if err := w.EmitBuffered(); err != nil {
+			t.Error(err)
+		}
+		if err := w.EmitBuffered(); err != nil {
+			t.Error(err)
+		}
+		if w.Buffered() != 0 {
+			t.Errorf("Expected empty buffer, got %d bytes", w.Buffered())
+		}
+		if len(tokens) != 2 || tokens[0] != "line" || tokens[1] != "partial \r" {
+			t.Errorf("Expected [%q %q], got %q", "line", "partial \r", tokens)
+		}
+
+		w.Close()
+		if err := w.EmitBuffered(); err != ErrClosed {
+			t.Errorf("Expected %q, got %q", ErrClosed, err)
+		}
+
+	}
+
+}
+
+func TestScannerWriterSignalEOF(t *testing.T) {
+
+	for _, newWriter := range []func(int, func([]byte) error) *ScannerWriter{
+		func(max int, tokenFunc func([]byte) error) *ScannerWriter {
+			return NewScannerWriter(bufio.ScanLines, max, tokenFunc)
+		},
+		NewLineScannerWriter,
+	} {
+
+		var tokens []string
+
+		w := newWriter(1<<10, func(token []byte) error {
+			tokens = append(tokens, string(token))
+			return nil
+		})
+
+		for _, stream := range []string{"one\ntwo", "three\nfour"} {
+			if _, err := w.Write([]byte(stream)); err != nil {
+				t.Error(err)
+			}
+			if err := w.SignalEOF(); err != nil {
+				t.Error(err)
+			}
+		}
+
+		if fmt.Sprint(tokens) != "[one two three four]" {
+			t.Errorf("Expected [one two three four], got %q", tokens)
+		}
+
+		w.Close()
+		if err := w.SignalEOF(); err != ErrClosed {
+			t.Errorf("Expected %q, got %q", ErrClosed, err)
+		}
+
+	}
+
+	// an incomplete stream is not joined with the next
+	var (
+		tokens []string
+		split  = func(data []byte, atEOF bool) (int, []byte, error) {
+			if atEOF && len(data) > 0 && data[len(data)-1] != ';' {
+				return 0, nil, errors.New("truncated")
+			}
+			if i := bytes.IndexByte(data, ';'); i >= 0 {
+				return i + 1, data[:i], nil
+			}
+			return 0, nil, nil
+		}
+		w = NewScannerWriter(split, 1<<10, func(token []byte) error {
+			tokens = append(tokens, string(token))
+			return nil
+		})
+	)
+
+	w.Write([]byte("a;b"))
+	if err := w.SignalEOF(); err == nil {
+		t.Error("Expected split error")
+	}
+	w.Write([]byte("c;"))
+	if err := w.SignalEOF(); err != nil {
+		t.Error(err)
+	}
+
+	if fmt.Sprint(tokens) != "[a c]" {
+		t.Errorf("Expected [a c], got %q", tokens)
+	}
+
+}
+
+func TestScannerWriterMaxProcessTime(t *testing.T) {
+
+	const lines = 100
+
+	var input []byte
+	for i := 0; i < lines; i++ {
+		input = append(input, fmt.Sprintf("line %d\n", i)...)
+	}
+
+	for _, newWriter := range []func(int, func([]byte) error) *ScannerWriter{
+		func(max int, tokenFunc func([]byte) error) *ScannerWriter {
+			return NewScannerWriter(bufio.ScanLines, max, tokenFunc)
+		},
+		NewLineScannerWriter,
+	} {
+
+		var tokens []string
+
+		w := newWriter(64, func(token []byte) error {
+			time.Sleep(time.Millisecond)
+			tokens = append(tokens, string(token))
+			return nil
+		})
+		w.MaxProcessTime = 5 * time.Millisecond
+
+		if n, err := w.Write(input); err != nil {
+			t.Error(err)
+		} else if n != len(input) {
+			t.Errorf("Expected %d bytes written, got %d", len(input), n)
+		}
+		if len(tokens) == lines {
+			t.Error("Expected Write to yield before processing every token")
+		}
+		if w.Buffered() == 0 {
+			t.Error("Expected unprocessed data to be retained")
+		}
+
+		for w.Buffered() > 0 && len(tokens) < lines/2 {
+			if _, err := w.Write(nil); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Error(err)
+		}
+
+		if len(tokens) != lines {
+			t.Fatalf("Expected %d tokens, got %d", lines, len(tokens))
+		}
+		for i, token := range tokens {
+			if token != fmt.Sprintf("line %d", i) {
+				t.Errorf("Expected %q, got %q", fmt.Sprintf("line %d", i), token)
+			}
+		}
+
+	}
+
+}
+
+func TestScannerWriterOnBuffered(t *testing.T) {
+
+	for _, newWriter := range []func(int, func([]byte) error) *ScannerWriter{
+		func(max int, tokenFunc func([]byte) error) *ScannerWriter {
+			return NewScannerWriter(bufio.ScanLines, max, tokenFunc)
+		},
+		NewLineScannerWriter,
+	} {
+
+		var pending []int
+
+		w := newWriter(64, func(token []byte) error { return nil })
+		w.OnBuffered = func(n int) {
+			pending = append(pending, n)
+		}
+
+		for i := 0; i < 3; i++ {
+			if _, err := w.Write([]byte("0123456789")); err != nil {
+				t.Error(err)
+			}
+		}
+		// emitting a token is not reported
+		if _, err := w.Write([]byte("\nabc")); err != nil {
+			t.Error(err)
+		}
+
+		if fmt.Sprint(pending) != "[10 20 30]" {
+			t.Errorf("Expected [10 20 30], got %v", pending)
+		}
+
+	}
+
+}
+
+func TestScannerWriterHighWaterMark(t *testing.T) {
+
+	for _, newWriter := range []func(int, func([]byte) error) *ScannerWriter{
+		func(max int, tokenFunc func([]byte) error) *ScannerWriter {
+			return NewScannerWriter(bufio.ScanLines, max, tokenFunc)
+		},
+		NewLineScannerWriter,
+	} {
+
+		// maxBufSize alone would allow the stream to grow to 1mb
+		w := newWriter(1<<20, func(token []byte) error { return nil })
+		w.HighWaterMark = 1 << 10
+
+		chunk := bytes.Repeat([]byte("x"), 100)
+
+		var (
+			written int
+			err     error
+		)
+		for written <= 1<<20 {
+			if _, err = w.Write(chunk); err != nil {
+				break
+			}
+			written += len(chunk)
+		}
+
+		if err != ErrBufferLimit {
+			t.Errorf("Expected %q, got %q", ErrBufferLimit, err)
+		}
+		if written > w.HighWaterMark {
+			t.Errorf("Expected the limit to trip after %d bytes, wrote %d", w.HighWaterMark, written)
+		}
+		if w.Buffered() != 0 {
+			t.Errorf("Expected the buffer to be discarded, got %d bytes", w.Buffered())
+		}
+
+	}
+
+}
+
+func TestOrderedScannerWriter(t *testing.T) {
+
+	var (
+		input     bytes.Buffer
+		committed []string
+	)
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&input, "%d\n", i)
+	}
+
+	w := NewOrderedScannerWriter(bufio.ScanLines, 1<<10, 8, func(token []byte) (interface{}, error) {
+		time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+		return string(token), nil
+	}, func(result interface{}) error {
+		committed = append(committed, result.(string))
+		return nil
+	})
+
+	if _, err := w.Write(input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(committed) != 200 {
+		t.Fatalf("Expected 200 results, got %d", len(committed))
+	}
+	for i, s := range committed {
+		if s != fmt.Sprint(i) {
+			t.Fatalf("Expected result %d to be %q, got %q", i, fmt.Sprint(i), s)
+		}
+	}
+
+	// nothing after a failed token is committed
+	committed = nil
+	failed := errors.New("failed")
+	w = NewOrderedScannerWriter(bufio.ScanLines, 1<<10, 8, func(token []byte) (interface{}, error) {
+		if string(token) == "50" {
+			return nil, failed
+		}
+		time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+		return string(token), nil
+	}, func(result interface{}) error {
+		committed = append(committed, result.(string))
+		return nil
+	})
+
+	w.Write(input.Bytes())
+	if err := w.Close(); err != failed {
+		t.Errorf("Expected %q, got %q", failed, err)
+	}
+	if len(committed) != 50 {
+		t.Errorf("Expected 50 results, got %d", len(committed))
+	}
+
+	// the workers are stopped when the final token fails to flush
+	before := runtime.NumGoroutine()
+	w = NewOrderedScannerWriter(bufio.ScanLines, 1<<10, 4, func(token []byte) (interface{}, error) {
+		return nil, failed
+	}, func(result interface{}) error {
+		return nil
+	})
+	w.Write([]byte("a\n"))
+	time.Sleep(20 * time.Millisecond)
+	w.Write([]byte("b"))
+	if err := w.Close(); err != failed {
+		t.Errorf("Expected %q, got %q", failed, err)
+	}
+	if _, err := w.Write([]byte("c\n")); err != ErrClosed {
+		t.Errorf("Expected %q, got %q", ErrClosed, err)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("Expected %d goroutines after Close, got %d", before, n)
+	}
+
+}
+
+func TestJoinScannerWriter(t *testing.T) {
+
+	var out bytes.Buffer
+
+	w := NewJoinScannerWriter(bufio.ScanWords, 1<<10, &out, []byte(" "))
+
+	for _, chunk := range []string{"  the   quick", "\tbrown  ", "\n\nfox jum", "ps  "} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if expected := "the quick brown fox jumps"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// the final token is written on Close
+	out.Reset()
+	w = NewJoinScannerWriter(bufio.ScanLines, 1<<10, &out, []byte(", "))
+	w.Write([]byte("a\nb\nc"))
+	w.Close()
+
+	if expected := "a, b, c"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+}
+
+func TestStatefulScannerWriter(t *testing.T) {
+
+	// lines until a BINARY line, then 4 byte records
+	type mode struct {
+		binary bool
+	}
+	split := func(m *mode, data []byte, atEOF bool) (int, []byte, error) {
+		if m.binary {
+			if len(data) < 4 {
+				if atEOF && len(data) > 0 {
+					return len(data), data, nil
+				}
+				return 0, nil, nil
+			}
+			return 4, data[:4], nil
+		}
+		adv, token, err := bufio.ScanLines(data, atEOF)
+		if string(token) == "BINARY" {
+			m.binary = true
+		}
+		return adv, token, err
+	}
+
+	var (
+		state  mode
+		tokens []string
+	)
+
+	w := NewStatefulScannerWriter(&state, split, 1<<10, func(token []byte) error {
+		tokens = append(tokens, string(token))
+		return nil
+	})
+
+	for _, chunk := range []string{"text\nmo", "re\nBIN", "ARY\nab\ncdef", "gh\ni"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"text", "more", "BINARY", "ab\nc", "defg", "h\ni"}
+	if fmt.Sprintf("%q", tokens) != fmt.Sprintf("%q", expected) {
+		t.Errorf("Expected %q, got %q", expected, tokens)
+	}
+	if !state.binary {
+		t.Error("Expected the state to be updated")
+	}
+
+	// a nil state starts from the zero value
+	tokens = nil
+	w = NewStatefulScannerWriter(nil, split, 1<<10, func(token []byte) error {
+		tokens = append(tokens, string(token))
+		return nil
+	})
+	w.Write([]byte("a\nb\n"))
+	w.Close()
+	if expected := []string{"a", "b"}; fmt.Sprint(tokens) != fmt.Sprint(expected) {
+		t.Errorf("Expected %q, got %q", expected, tokens)
+	}
+
+}
+
+func TestScannerWriterReentrant(t *testing.T) {
+
+	var (
+		w      *ScannerWriter
+		tokens []string
+		errs   []error
+	)
+
+	w = NewScannerWriter(bufio.ScanWords, 1<<10, func(token []byte) error {
+		tokens = append(tokens, string(token))
+		if _, err := w.Write([]byte("x y ")); err != nil {
+			errs = append(errs, err)
+		}
+		if err := w.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+
+	if _, err := w.Write([]byte("a b c")); err != nil {
+		t.Error(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if expected := []string{"a", "b", "c"}; fmt.Sprint(tokens) != fmt.Sprint(expected) {
+		t.Errorf("Expected %q, got %q", expected, tokens)
+	}
+	if len(errs) != 3*len(tokens) {
+		t.Errorf("Expected %d errors, got %d", 3*len(tokens), len(errs))
+	}
+	for _, err := range errs {
+		if err != ErrReentrant {
+			t.Errorf("Expected %q, got %q", ErrReentrant, err)
+		}
+	}
+
+}
+
 func BenchmarkScannerWriterScan7Bytes(b *testing.B) {
-	runBenchmarkScannerWriter([]byte("Gibbons"), b)
+	runBenchmarkScannerWriter(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), []byte("Gibbons"), b)
 }
 func BenchmarkScannerWriterScan22Bytes(b *testing.B) {
-	runBenchmarkScannerWriter([]byte("Gibbons (/ˈɡɪbənz/[3])"), b)
+	runBenchmarkScannerWriter(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3])"), b)
 }
 func BenchmarkScannerWriterScan31Bytes(b *testing.B) {
-	runBenchmarkScannerWriter([]byte("Gibbons (/ˈɡɪbənz/[3]) are apes"), b)
+	runBenchmarkScannerWriter(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3]) are apes"), b)
 }
 func BenchmarkScannerWriterScan57Bytes(b *testing.B) {
-	runBenchmarkScannerWriter([]byte("Gibbons (/ˈɡɪbənz/[3]) are apes in the family Hylobatidae"), b)
+	runBenchmarkScannerWriter(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3]) are apes in the family Hylobatidae"), b)
 }
 func BenchmarkScannerWriterScan75Bytes(b *testing.B) {
-	runBenchmarkScannerWriter([]byte("Gibbons (/ˈɡɪbənz/[3]) are apes in the family Hylobatidae /ˌhaɪloʊbəˈtaɪdeɪ"), b)
+	runBenchmarkScannerWriter(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3]) are apes in the family Hylobatidae /ˌhaɪloʊbəˈtaɪdeɪ"), b)
 }
 func BenchmarkScannerWriterScan1572Bytes(b *testing.B) {
-	runBenchmarkScannerWriter(data, b)
+	runBenchmarkScannerWriter(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), data, b)
+}
+
+func BenchmarkWordScannerWriterScan7Bytes(b *testing.B) {
+	runBenchmarkScannerWriter(NewWordScannerWriter(1<<10, nopTokenFunc), []byte("Gibbons"), b)
+}
+func BenchmarkWordScannerWriterScan22Bytes(b *testing.B) {
+	runBenchmarkScannerWriter(NewWordScannerWriter(1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3])"), b)
+}
+func BenchmarkWordScannerWriterScan31Bytes(b *testing.B) {
+	runBenchmarkScannerWriter(NewWordScannerWriter(1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3]) are apes"), b)
+}
+func BenchmarkWordScannerWriterScan57Bytes(b *testing.B) {
+	runBenchmarkScannerWriter(NewWordScannerWriter(1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3]) are apes in the family Hylobatidae"), b)
+}
+func BenchmarkWordScannerWriterScan75Bytes(b *testing.B) {
+	runBenchmarkScannerWriter(NewWordScannerWriter(1<<10, nopTokenFunc), []byte("Gibbons (/ˈɡɪbənz/[3]) are apes in the family Hylobatidae /ˌhaɪloʊbəˈtaɪdeɪ"), b)
+}
+func BenchmarkWordScannerWriterScan1572Bytes(b *testing.B) {
+	runBenchmarkScannerWriter(NewWordScannerWriter(1<<10, nopTokenFunc), data, b)
+}
+
+func BenchmarkScannerWriterChunked(b *testing.B) {
+	runBenchmarkScannerWriterChunked(NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc), b)
+}
+func BenchmarkScannerWriterChunkedPool(b *testing.B) {
+	w := NewScannerWriter(bufio.ScanWords, 1<<10, nopTokenFunc)
+	w.BufferPool = &sync.Pool{}
+	runBenchmarkScannerWriterChunked(w, b)
+}
+func BenchmarkWordScannerWriterChunked(b *testing.B) {
+	runBenchmarkScannerWriterChunked(NewWordScannerWriter(1<<10, nopTokenFunc), b)
+}
+func BenchmarkScannerWriterChunkedLines(b *testing.B) {
+	runBenchmarkScannerWriterChunked(NewScannerWriter(bufio.ScanLines, 1<<10, nopTokenFunc), b)
+}
+func BenchmarkLineScannerWriterChunked(b *testing.B) {
+	runBenchmarkScannerWriterChunked(NewLineScannerWriter(1<<10, nopTokenFunc), b)
+}
+
+// writes in chunks that split tokens, forcing data to be buffered
+func runBenchmarkScannerWriterChunked(w *ScannerWriter, b *testing.B) {
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for chunk := data; len(chunk) > 0; {
+			n := 61
+			if n > len(chunk) {
+				n = len(chunk)
+			}
+			w.Write(chunk[:n])
+			chunk = chunk[n:]
+		}
+	}
+
+	b.StopTimer()
+
+	w.Close()
+
 }
 
-func runBenchmarkScannerWriter(body []byte, b *testing.B) {
+func nopTokenFunc(_ []byte) error { return nil }
 
-	w := NewScannerWriter(bufio.ScanWords, 1<<10, func(_ []byte) error { return nil })
+func runBenchmarkScannerWriter(w *ScannerWriter, body []byte, b *testing.B) {
 
 	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
 
 	b.ResetTimer()
 
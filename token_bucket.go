@@ -0,0 +1,64 @@
+package extio
+
+import "time"
+
+type (
+	// A tokenBucket limits throughput to a sustained rate while
+	// permitting bursts up to its capacity.  Consumption may take
+	// the bucket into debt, which is repaid before the next wait
+	// returns.
+	tokenBucket struct {
+		rate   float64 // tokens per second
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+)
+
+// Creates a full tokenBucket.
+func newTokenBucket(rate, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Adds tokens accrued since the last refill.
+func (tb *tokenBucket) refill() {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// Blocks until the bucket has tokens available.  Returns
+// ErrAborted if abort is closed while waiting.
+func (tb *tokenBucket) wait(abort <-chan struct{}) error {
+
+	tb.refill()
+
+	if tb.tokens > 0 {
+		return nil
+	}
+
+	t := time.NewTimer(time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second)))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		tb.refill()
+		return nil
+	case <-abort:
+		return ErrAborted
+	}
+
+}
+
+// Consumes n tokens.
+func (tb *tokenBucket) take(n int) {
+	tb.tokens -= float64(n)
+}